@@ -2,11 +2,15 @@ package v1alpha1
 
 import (
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
 )
 
 // redis基础配置
 type KubernetesConfig struct {
-	Image                  string                         `json:"image"`
+	// 未设置时使用flavor对应的默认镜像，flavor为redis时必须设置
+	Image                  string                         `json:"image,omitempty"`
 	ImagePullPolicy        corev1.PullPolicy              `json:"imagePullPolicy,omitempty"`
 	Resources              *corev1.ResourceRequirements   `json:"resources,omitempty"`
 	ExistingPasswordSecret *ExistingPasswordSecret        `json:"redisSecret,omitempty"`
@@ -36,6 +40,47 @@ type RedisExporter struct {
 	Resources       *corev1.ResourceRequirements `json:"resources,omitempty"`
 	ImagePullPolicy corev1.PullPolicy            `json:"imagePullPolicy,omitempty"`
 	EnvVars         *[]corev1.EnvVar             `json:"env,omitempty"`
+	// 为exporter创建Prometheus Operator的ServiceMonitor或PodMonitor，CRD不存在时跳过
+	Monitor *RedisMonitor `json:"monitor,omitempty"`
+}
+
+// Prometheus Operator监控对象配置
+type RedisMonitor struct {
+	Enabled bool `json:"enabled,omitempty"`
+	// +kubebuilder:validation:Enum=ServiceMonitor;PodMonitor
+	// +kubebuilder:default=ServiceMonitor
+	Kind string `json:"kind,omitempty"`
+	// 抓取间隔，如30s，未设置时使用Prometheus默认值
+	Interval string `json:"interval,omitempty"`
+	// 抓取超时，不能大于interval
+	ScrapeTimeout string `json:"scrapeTimeout,omitempty"`
+	// 添加到监控对象上，供Prometheus的serviceMonitorSelector/podMonitorSelector选择
+	Labels map[string]string `json:"labels,omitempty"`
+	// 抓取前对target标签的重写规则
+	Relabelings []RelabelConfig `json:"relabelings,omitempty"`
+	// 写入前对指标标签的重写规则
+	MetricRelabelings []RelabelConfig `json:"metricRelabelings,omitempty"`
+	// exporter使用实例证书提供https，需开启TLS或autoTLS
+	TLS *MonitorTLSConfig `json:"tls,omitempty"`
+}
+
+// Prometheus标签重写规则
+type RelabelConfig struct {
+	SourceLabels []string `json:"sourceLabels,omitempty"`
+	Separator    string   `json:"separator,omitempty"`
+	TargetLabel  string   `json:"targetLabel,omitempty"`
+	Regex        string   `json:"regex,omitempty"`
+	Modulus      uint64   `json:"modulus,omitempty"`
+	Replacement  string   `json:"replacement,omitempty"`
+	// +kubebuilder:validation:Enum=replace;keep;drop;hashmod;labelmap;labeldrop;labelkeep
+	Action string `json:"action,omitempty"`
+}
+
+// 抓取exporter时的TLS配置，CA取自实例证书secret
+type MonitorTLSConfig struct {
+	// 校验证书的域名，默认<name>.<namespace>.svc
+	ServerName         string `json:"serverName,omitempty"`
+	InsecureSkipVerify bool   `json:"insecureSkipVerify,omitempty"`
 }
 
 // tls配置
@@ -43,8 +88,44 @@ type TLSConfig struct {
 	CaKeyFile   string `json:"ca,omitempty"`
 	CertKeyFile string `json:"cert,omitempty"`
 	KeyFile     string `json:"key,omitempty"`
-	// 包含证书的secret的引用
+	// 包含证书的secret的引用，证书SAN需包含service域名(<name>.<namespace>.svc)或pod域名(<pod>.<name>-headless.<namespace>.svc)
 	Secret corev1.SecretVolumeSource `json:"secret"`
+	// 通过cert-manager签发证书，证书写入secret.secretName，未设置时为<name>-tls
+	IssuerRef *CertManagerIssuerRef `json:"issuerRef,omitempty"`
+	// 签发客户端证书的CA secret，包含ca.crt及ca.key，不挂载到pod中，CA需为redis信任的CA
+	CASigningSecret string `json:"caSigningSecret,omitempty"`
+	TLSOptions      `json:",inline"`
+}
+
+// TLS服务端选项，TLS端口固定为6379
+type TLSOptions struct {
+	// 同时开放的明文端口，未设置时禁用明文端口(port 0)
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=65535
+	PlaintextPort *int32 `json:"plaintextPort,omitempty"`
+	// 是否要求客户端证书，未设置时不写入tls-auth-clients，沿用镜像配置（redis默认yes）
+	// +kubebuilder:validation:Enum=yes;no;optional
+	AuthClients string `json:"authClients,omitempty"`
+	// 允许的TLS协议版本，如TLSv1.2、TLSv1.3
+	Protocols []string `json:"protocols,omitempty"`
+	// TLSv1.2及以下使用的加密套件
+	Ciphers string `json:"ciphers,omitempty"`
+	// TLSv1.3使用的加密套件
+	Ciphersuites string `json:"ciphersuites,omitempty"`
+	// 主从复制是否使用TLS，默认true，未开放明文端口时必须为true
+	Replication *bool `json:"replication,omitempty"`
+	// 集群总线是否使用TLS，默认true，未开放明文端口时必须为true
+	Cluster *bool `json:"cluster,omitempty"`
+}
+
+// cert-manager签发者引用
+type CertManagerIssuerRef struct {
+	Name string `json:"name"`
+	// +kubebuilder:validation:Enum=Issuer;ClusterIssuer
+	// +kubebuilder:default=Issuer
+	Kind string `json:"kind,omitempty"`
+	// +kubebuilder:default=cert-manager.io
+	Group string `json:"group,omitempty"`
 }
 
 // ReadinessProbe and LivenessProbe探针接口
@@ -63,3 +144,354 @@ type Sidecar struct {
 	Resouces        *corev1.ResourceRequirements `json:"resources,omitempty"`
 	EnvVars         *[]corev1.EnvVar             `json:"env,omitempty"`
 }
+
+// 备份文件存储位置，s3与pvc二选一
+type BackupStorage struct {
+	S3  *S3BackupStorage  `json:"s3,omitempty"`
+	PVC *PVCBackupStorage `json:"pvc,omitempty"`
+}
+
+// 兼容S3协议的对象存储
+type S3BackupStorage struct {
+	// 对象存储地址，如http://minio.minio:9000
+	Endpoint string `json:"endpoint"`
+	Bucket   string `json:"bucket"`
+	// 备份文件key前缀
+	Prefix string `json:"prefix,omitempty"`
+	// 跳过对象存储的证书校验
+	Insecure bool `json:"insecure,omitempty"`
+	// 包含AWS_ACCESS_KEY_ID和AWS_SECRET_ACCESS_KEY的secret
+	CredentialsSecret corev1.LocalObjectReference `json:"credentialsSecret"`
+}
+
+// 使用已存在的pvc存储备份文件
+type PVCBackupStorage struct {
+	ClaimName string `json:"claimName"`
+	// 备份文件在pvc中的目录
+	Path string `json:"path,omitempty"`
+}
+
+// 备份保留策略，按数量和时间清理已完成的备份
+type BackupRetention struct {
+	// 保留的成功备份数量，失败的备份不计入
+	MaxCount *int32           `json:"maxCount,omitempty"`
+	MaxAge   *metav1.Duration `json:"maxAge,omitempty"`
+	// 保留的失败备份数量，便于排查问题
+	// +kubebuilder:default:=3
+	MaxFailedCount *int32 `json:"maxFailedCount,omitempty"`
+}
+
+// 数据恢复来源，backupName、pvc、s3、url四选一
+type RestoreSource struct {
+	// 同一namespace下已成功的RedisBackup名称
+	BackupName string `json:"backupName,omitempty"`
+	// pvc中的RDB文件
+	PVC *PVCRestoreSource `json:"pvc,omitempty"`
+	// 对象存储中的RDB文件
+	S3 *S3RestoreSource `json:"s3,omitempty"`
+	// 可通过HTTP(S)下载的RDB文件地址
+	URL string `json:"url,omitempty"`
+	// RDB文件的sha256校验值，从RedisBackup恢复时默认使用备份记录的校验值
+	Checksum string `json:"checksum,omitempty"`
+	// 数据卷非空时清空后恢复，默认拒绝覆盖已有数据
+	Force bool `json:"force,omitempty"`
+	// 恢复使用的init容器镜像，默认按来源选择minio/mc、busybox或curlimages/curl
+	Image           string            `json:"image,omitempty"`
+	ImagePullPolicy corev1.PullPolicy `json:"imagePullPolicy,omitempty"`
+}
+
+type PVCRestoreSource struct {
+	ClaimName string `json:"claimName"`
+	// RDB文件在pvc中的路径
+	Path string `json:"path"`
+}
+
+type S3RestoreSource struct {
+	Endpoint string `json:"endpoint"`
+	Bucket   string `json:"bucket"`
+	// RDB文件的对象key
+	Key      string `json:"key"`
+	Insecure bool   `json:"insecure,omitempty"`
+	// 包含AWS_ACCESS_KEY_ID和AWS_SECRET_ACCESS_KEY的secret
+	CredentialsSecret corev1.LocalObjectReference `json:"credentialsSecret"`
+}
+
+// 外部redis迁移源
+type MigrationSpec struct {
+	Host string `json:"host"`
+	// +kubebuilder:default=6379
+	Port int32 `json:"port,omitempty"`
+	// 源端ACL用户名，为空时使用default用户
+	Username string `json:"username,omitempty"`
+	// 源端密码secret
+	PasswordSecret *ExistingPasswordSecret `json:"passwordSecret,omitempty"`
+	// 使用TLS连接源端，复制链路由redis按实例自身的TLS配置建立，源端需信任实例证书的CA
+	TLS bool `json:"tls,omitempty"`
+	// operator查询源端复制偏移量时使用的证书配置
+	TLSConfig *MigrationTLSConfig `json:"tlsConfig,omitempty"`
+	// 允许切换的最大复制偏移量差值，默认为0，即需停止源端写入并同步完成后切换
+	// +kubebuilder:validation:Minimum=0
+	MaxCutoverLag int64 `json:"maxCutoverLag,omitempty"`
+}
+
+// operator连接迁移源端的证书配置
+type MigrationTLSConfig struct {
+	// 包含ca.crt的secret，用于校验源端证书，未设置时使用系统根证书
+	CASecret string `json:"caSecret,omitempty"`
+	// 包含tls.crt及tls.key的secret，源端要求客户端证书时设置
+	ClientCertSecret string `json:"clientCertSecret,omitempty"`
+	// 校验源端证书使用的域名，默认为host
+	ServerName string `json:"serverName,omitempty"`
+}
+
+type MigrationPhase string
+
+const (
+	MigrationPhaseSyncing MigrationPhase = "Syncing"
+	MigrationPhaseSynced  MigrationPhase = "Synced"
+	MigrationPhaseCutOver MigrationPhase = "CutOver"
+	MigrationPhaseFailed  MigrationPhase = "Failed"
+)
+
+// 迁移同步状态
+type MigrationStatus struct {
+	Phase            MigrationPhase `json:"phase,omitempty"`
+	MasterLinkStatus string         `json:"masterLinkStatus,omitempty"`
+	// 源端master_repl_offset
+	SourceOffset int64 `json:"sourceOffset,omitempty"`
+	// 本实例已同步的复制偏移量
+	ReplicaOffset int64 `json:"replicaOffset,omitempty"`
+	// 源端与本实例的复制偏移量差值
+	Lag         int64        `json:"lag,omitempty"`
+	CutoverTime *metav1.Time `json:"cutoverTime,omitempty"`
+	Message     string       `json:"message,omitempty"`
+}
+
+// PodDisruptionBudget配置，minAvailable与maxUnavailable只能设置一个
+// 单例只有一个pod，均未设置时不创建PodDisruptionBudget并发出告警事件，需阻止驱逐时设置minAvailable为1
+type RedisPodDisruptionBudget struct {
+	Enabled        bool                `json:"enabled,omitempty"`
+	MinAvailable   *intstr.IntOrString `json:"minAvailable,omitempty"`
+	MaxUnavailable *intstr.IntOrString `json:"maxUnavailable,omitempty"`
+}
+
+type PersistenceMode string
+
+const (
+	PersistenceModeRDB    PersistenceMode = "rdb"
+	PersistenceModeAOF    PersistenceMode = "aof"
+	PersistenceModeHybrid PersistenceMode = "hybrid"
+	// 纯缓存，不持久化也不创建pvc
+	PersistenceModeNone PersistenceMode = "none"
+)
+
+// 持久化配置，rdb、aof、hybrid需要设置spec.storage，none不能设置spec.storage
+type Persistence struct {
+	// +kubebuilder:validation:Enum=rdb;aof;hybrid;none
+	Mode PersistenceMode `json:"mode"`
+	RDB  *RDBPersistence `json:"rdb,omitempty"`
+	AOF  *AOFPersistence `json:"aof,omitempty"`
+}
+
+// RDB快照配置，未设置保存规则时使用redis默认规则
+type RDBPersistence struct {
+	SaveRules   []RDBSaveRule `json:"saveRules,omitempty"`
+	Compression *bool         `json:"compression,omitempty"`
+}
+
+// 在seconds秒内至少有changes次修改时保存快照
+type RDBSaveRule struct {
+	// +kubebuilder:validation:Minimum=1
+	Seconds int32 `json:"seconds"`
+	// +kubebuilder:validation:Minimum=1
+	Changes int32 `json:"changes"`
+}
+
+// AOF配置
+type AOFPersistence struct {
+	// +kubebuilder:validation:Enum=always;everysec;no
+	AppendFsync string `json:"appendfsync,omitempty"`
+	// AOF文件较上次重写增长的百分比达到该值时自动重写，0表示关闭自动重写
+	// +kubebuilder:validation:Minimum=0
+	AutoRewritePercentage *int32 `json:"autoRewritePercentage,omitempty"`
+	// 自动重写的最小AOF文件大小
+	AutoRewriteMinSize *resource.Quantity `json:"autoRewriteMinSize,omitempty"`
+}
+
+// 节点调优配置，privileged为false时只能通过pod sysctls设置somaxconn，需要kubelet允许该sysctl
+type NodeTuning struct {
+	Enabled bool `json:"enabled,omitempty"`
+	// 使用特权init容器修改内核参数
+	Privileged bool `json:"privileged,omitempty"`
+	// net.core.somaxconn，非特权模式下通过pod sysctls设置，属于unsafe sysctl，
+	// 需kubelet配置--allowed-unsafe-sysctls=net.core.somaxconn，否则pod被拒绝运行(SysctlForbidden)
+	// +kubebuilder:validation:Minimum=128
+	Somaxconn *int32 `json:"somaxconn,omitempty"`
+	// 关闭透明大页，需要privileged
+	DisableTHP bool `json:"disableTHP,omitempty"`
+	// 设置vm.overcommit_memory=1，需要privileged
+	OvercommitMemory bool `json:"overcommitMemory,omitempty"`
+	// 特权init容器镜像，默认busybox
+	Image           string            `json:"image,omitempty"`
+	ImagePullPolicy corev1.PullPolicy `json:"imagePullPolicy,omitempty"`
+}
+
+// maxmemory配置，设置了maxMemory时直接使用，否则按容器内存limit的百分比计算，预留fork写时复制及复制缓冲区的空间
+type RedisMemory struct {
+	// +kubebuilder:validation:Minimum=10
+	// +kubebuilder:validation:Maximum=100
+	MaxMemoryPercent *int32             `json:"maxMemoryPercent,omitempty"`
+	MaxMemory        *resource.Quantity `json:"maxMemory,omitempty"`
+	// +kubebuilder:validation:Enum=noeviction;allkeys-lru;allkeys-lfu;allkeys-random;volatile-lru;volatile-lfu;volatile-random;volatile-ttl
+	MaxMemoryPolicy string `json:"maxMemoryPolicy,omitempty"`
+}
+
+// redis模块，path、url、image三选一
+type RedisModule struct {
+	// +kubebuilder:validation:Pattern=`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`
+	Name string `json:"name"`
+	// 镜像内的模块文件路径
+	Path string `json:"path,omitempty"`
+	// 通过HTTP(S)下载的模块文件地址
+	URL string `json:"url,omitempty"`
+	// 包含模块文件的OCI制品，由oras init容器拉取，需可匿名拉取
+	Image string `json:"image,omitempty"`
+	// 制品中的模块文件名，即oras push时的文件路径
+	ImagePath       string            `json:"imagePath,omitempty"`
+	ImagePullPolicy corev1.PullPolicy `json:"imagePullPolicy,omitempty"`
+	// loadmodule参数
+	Args []string `json:"args,omitempty"`
+}
+
+// 已加载模块信息
+type ModuleStatus struct {
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"`
+}
+
+type RedisFlavor string
+
+const (
+	RedisFlavorRedis     RedisFlavor = "redis"
+	RedisFlavorValkey    RedisFlavor = "valkey"
+	RedisFlavorKeyDB     RedisFlavor = "keydb"
+	RedisFlavorDragonfly RedisFlavor = "dragonfly"
+)
+
+// 引擎相关的特性配置
+type EngineOptions struct {
+	// 工作线程数，redis/valkey对应io-threads，keydb对应server-threads，dragonfly对应proactor_threads
+	// +kubebuilder:validation:Minimum=1
+	Threads *int32 `json:"threads,omitempty"`
+	// 多主复制，仅keydb支持
+	ActiveReplication bool `json:"activeReplication,omitempty"`
+}
+
+// operator自动签发的TLS证书配置
+type AutoTLSConfig struct {
+	Enabled bool `json:"enabled,omitempty"`
+	// 证书有效期，默认2160h
+	Duration *metav1.Duration `json:"duration,omitempty"`
+	// 到期前多久续签，默认720h
+	RenewBefore *metav1.Duration `json:"renewBefore,omitempty"`
+	TLSOptions  `json:",inline"`
+}
+
+// 访问控制配置，同一部署拓扑内的pod及operator始终允许访问
+type RedisAccess struct {
+	// 允许访问redis端口的客户端，为空时仅允许拓扑内及operator访问
+	From []AccessPeer `json:"from,omitempty"`
+	// 允许访问exporter端口的监控namespace，默认monitoring
+	MonitoringNamespace string `json:"monitoringNamespace,omitempty"`
+}
+
+// 允许访问的客户端，namespaceSelector与podSelector同时设置时需同时满足，cidr不能与selector同时设置
+type AccessPeer struct {
+	NamespaceSelector *metav1.LabelSelector `json:"namespaceSelector,omitempty"`
+	PodSelector       *metav1.LabelSelector `json:"podSelector,omitempty"`
+	// 如10.0.0.0/8
+	CIDR string `json:"cidr,omitempty"`
+	// 从cidr中排除的网段
+	Except []string `json:"except,omitempty"`
+}
+
+// 告警规则配置
+type RedisAlerts struct {
+	Enabled bool `json:"enabled,omitempty"`
+	// 添加到PrometheusRule上，供Prometheus的ruleSelector选择
+	Labels map[string]string `json:"labels,omitempty"`
+	// 禁用的告警，如RedisHighEvictions
+	Disabled []string `json:"disabled,omitempty"`
+	// 告警持续时间，默认5m
+	// +kubebuilder:validation:Pattern=`^([0-9]+(ms|s|m|h|d|w|y))+$`
+	For string `json:"for,omitempty"`
+	// 内存使用占maxmemory的百分比阈值，默认90
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=100
+	MemoryUsagePercent *int32 `json:"memoryUsagePercent,omitempty"`
+	// 每分钟拒绝连接数阈值，默认0
+	// +kubebuilder:validation:Minimum=0
+	RejectedConnections *int32 `json:"rejectedConnections,omitempty"`
+	// 每秒淘汰key数阈值，默认100
+	// +kubebuilder:validation:Minimum=0
+	EvictionsPerSecond *int32 `json:"evictionsPerSecond,omitempty"`
+}
+
+// redis运行状态，由operator定期执行PING及INFO获取
+type RedisHealth struct {
+	// master或slave
+	Role string `json:"role,omitempty"`
+	// 是否正在加载数据
+	Loading           bool  `json:"loading,omitempty"`
+	UsedMemory        int64 `json:"usedMemory,omitempty"`
+	MaxMemory         int64 `json:"maxMemory,omitempty"`
+	ConnectedClients  int64 `json:"connectedClients,omitempty"`
+	ConnectedReplicas int64 `json:"connectedReplicas,omitempty"`
+	// 从节点与主节点的连接状态
+	MasterLinkStatus string `json:"masterLinkStatus,omitempty"`
+	// INFO server中的版本号
+	Version string `json:"version,omitempty"`
+	// 最近一次BGSAVE结果，ok或err
+	LastSaveStatus string       `json:"lastSaveStatus,omitempty"`
+	LastSaveTime   *metav1.Time `json:"lastSaveTime,omitempty"`
+	// 最近一次AOF写入结果，ok或err
+	AOFWriteStatus string       `json:"aofWriteStatus,omitempty"`
+	LastCheckTime  *metav1.Time `json:"lastCheckTime,omitempty"`
+}
+
+// 版本升级策略
+type UpgradeStrategy struct {
+	// 设置后在切换镜像前执行一次备份，备份成功后才开始升级
+	PreUpgradeBackup *BackupStorage `json:"preUpgradeBackup,omitempty"`
+	// 等待pod就绪的最长时间，超时后停止升级并设置Degraded状态，单位为秒
+	// +kubebuilder:default:=600
+	ReadyTimeoutSeconds *int32 `json:"readyTimeoutSeconds,omitempty"`
+}
+
+// 升级阶段
+type UpgradePhase string
+
+const (
+	UpgradePhaseBackingUp UpgradePhase = "BackingUp"
+	UpgradePhaseUpgrading UpgradePhase = "Upgrading"
+	UpgradePhaseCompleted UpgradePhase = "Completed"
+	// 降级跨越RDB格式版本，拒绝升级
+	UpgradePhaseRefused UpgradePhase = "Refused"
+	// 升级前备份失败，未下发新镜像，修改镜像后重新开始
+	UpgradePhaseHalted UpgradePhase = "Halted"
+	// 新镜像已下发，但pod未就绪或版本不符，不会自动回滚
+	UpgradePhaseUnverified UpgradePhase = "Unverified"
+)
+
+// 版本升级状态
+type UpgradeStatus struct {
+	Phase       UpgradePhase `json:"phase,omitempty"`
+	FromImage   string       `json:"fromImage,omitempty"`
+	ToImage     string       `json:"toImage,omitempty"`
+	FromVersion string       `json:"fromVersion,omitempty"`
+	ToVersion   string       `json:"toVersion,omitempty"`
+	// 升级前备份对象名称
+	Backup    string       `json:"backup,omitempty"`
+	StartTime *metav1.Time `json:"startTime,omitempty"`
+	Message   string       `json:"message,omitempty"`
+}
@@ -39,14 +39,84 @@ type RedisSpec struct {
 	ReadinessProbe    *Probe                     `json:"readinessProbe,omitempty" protobuf:"bytes,11,opt,name=readinessProbe"`
 	LivenessProbe     *Probe                     `json:"livenessProbe,omitempty" protobuf:"bytes,11,opt,name=livenessProbe"`
 	Sidecars          *[]Sidecar                 `json:"sidecars,omitempty"`
+	// 创建时从备份恢复数据，仅在数据卷为空时生效
+	RestoreFrom *RestoreSource `json:"restoreFrom,omitempty"`
+	// 从外部redis在线迁移数据，作为其从节点同步直至切换
+	Migration           *MigrationSpec            `json:"migration,omitempty"`
+	PodDisruptionBudget *RedisPodDisruptionBudget `json:"podDisruptionBudget,omitempty"`
+	// pod停止前等待数据落盘的最长时间，新建实例默认300秒，已有实例未设置时保持statefulset当前值，数据量较大时需调大
+	// +kubebuilder:validation:Minimum=0
+	TerminationGracePeriodSeconds *int64 `json:"terminationGracePeriodSeconds,omitempty"`
+	// 持久化方式，未设置时由镜像按PERSISTENCE_ENABLED决定
+	Persistence *Persistence `json:"persistence,omitempty"`
+	// 节点内核参数调优
+	NodeTuning *NodeTuning `json:"nodeTuning,omitempty"`
+	// maxmemory配置，未设置时按容器内存limit的75%计算
+	Memory *RedisMemory `json:"memory,omitempty"`
+	// 在operator生成的init容器之后执行
+	InitContainers []corev1.Container `json:"initContainers,omitempty"`
+	// 不能与external-config、tls-certs及数据卷重名
+	Volumes []corev1.Volume `json:"volumes,omitempty"`
+	// 挂载到redis容器
+	VolumeMounts []corev1.VolumeMount `json:"volumeMounts,omitempty"`
+	// 启动时加载的redis模块
+	// +listType=map
+	// +listMapKey=name
+	Modules []RedisModule `json:"modules,omitempty"`
+	// 服务端引擎，决定默认镜像、配置语法及支持的特性
+	// +kubebuilder:validation:Enum=redis;valkey;keydb;dragonfly
+	// +kubebuilder:default=redis
+	Flavor RedisFlavor    `json:"flavor,omitempty"`
+	Engine *EngineOptions `json:"engine,omitempty"`
+	// 由operator自建CA签发证书，与TLS不能同时设置
+	AutoTLS *AutoTLSConfig `json:"autoTLS,omitempty"`
+	// 允许通过RedisClientCertificate为本实例签发客户端证书的其他namespace，本实例所在namespace始终允许
+	ClientCertificateNamespaces []string `json:"clientCertificateNamespaces,omitempty"`
+	// 访问控制，设置后生成NetworkPolicy，仅允许列出的客户端访问
+	Access *RedisAccess `json:"access,omitempty"`
+	// 生成PrometheusRule告警规则，CRD不存在时跳过
+	Alerts *RedisAlerts `json:"alerts,omitempty"`
+	// 到达该时间后重启pod（单例模式仅有一个pod），修改为更晚的时间可再次重启
+	RestartAt *metav1.Time `json:"restartAt,omitempty"`
+	// 修改镜像时的升级策略
+	Upgrade *UpgradeStrategy `json:"upgrade,omitempty"`
 }
 
 // RedisStatus defines the observed state of Redis
 type RedisStatus struct {
 	// INSERT ADDITIONAL STATUS FIELD - define observed state of cluster
 	// Important: Run "make" to regenerate code after modifying this file
+
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty" patchStrategy:"merge" patchMergeKey:"type"`
+	Migration  *MigrationStatus   `json:"migration,omitempty"`
+	// MODULE LIST返回的已加载模块
+	Modules []ModuleStatus `json:"modules,omitempty"`
+	// operator通过INFO获取的运行状态
+	Health *RedisHealth `json:"health,omitempty"`
+	// 最近一次镜像变更的升级状态
+	Upgrade *UpgradeStatus `json:"upgrade,omitempty"`
 }
 
+// redis状态条件类型
+const (
+	// 数据是否已从restoreFrom恢复
+	ConditionRestored string = "Restored"
+	// 是否已从外部redis迁移并完成切换
+	ConditionMigrated string = "Migrated"
+	// 节点调优是否生效
+	ConditionNodeTuned string = "NodeTuned"
+	// maxmemory是否在容器内存limit范围内
+	ConditionMaxMemoryValid string = "MaxMemoryValid"
+	// redis是否可访问且可正常读写
+	ConditionHealthy string = "Healthy"
+	// 是否暂停协调
+	ConditionPaused string = "Paused"
+	// 升级失败等需要人工介入的状态
+	ConditionDegraded string = "Degraded"
+)
+
 //+kubebuilder:object:root=true
 //+kubebuilder:subresource:status
 
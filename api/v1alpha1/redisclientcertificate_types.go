@@ -0,0 +1,88 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// RedisClientCertificateSpec defines the desired state of RedisClientCertificate
+type RedisClientCertificateSpec struct {
+	// 签发证书的redis实例名称
+	RedisName string `json:"redisName"`
+	// redis实例所在namespace，默认与本对象相同，不同时需在redis的clientCertificateNamespaces中允许本namespace
+	RedisNamespace string `json:"redisNamespace,omitempty"`
+	// 写入客户端证书的secret名称，位于本对象所在namespace
+	SecretName string `json:"secretName"`
+	// 证书CN，映射ACL用户时即为用户名，默认为本对象名称
+	CommonName string `json:"commonName,omitempty"`
+	// 将证书CN映射为redis ACL用户，通过tls-auth-clients-user CN认证，需要valkey 9.0及以上版本
+	ACLUser *ClientCertificateACLUser `json:"aclUser,omitempty"`
+	// 证书有效期，默认2160h
+	Duration *metav1.Duration `json:"duration,omitempty"`
+	// 到期前多久轮换，默认720h
+	RenewBefore *metav1.Duration `json:"renewBefore,omitempty"`
+	// 吊销证书，删除对应的ACL用户及证书secret
+	// 证书在有效期内仍能通过TLS握手，仅当default用户需要密码认证时吊销才能阻止访问
+	Revoked bool `json:"revoked,omitempty"`
+}
+
+// 证书CN对应的ACL用户
+type ClientCertificateACLUser struct {
+	// ACL规则，如"~app:* +@read"
+	Rules string `json:"rules"`
+}
+
+// RedisClientCertificateStatus defines the observed state of RedisClientCertificate
+type RedisClientCertificateStatus struct {
+	SerialNumber string       `json:"serialNumber,omitempty"`
+	NotBefore    *metav1.Time `json:"notBefore,omitempty"`
+	NotAfter     *metav1.Time `json:"notAfter,omitempty"`
+	// 已创建的ACL用户
+	ACLUser string `json:"aclUser,omitempty"`
+	Revoked bool   `json:"revoked,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="Redis",type=string,JSONPath=`.spec.redisName`
+//+kubebuilder:printcolumn:name="Secret",type=string,JSONPath=`.spec.secretName`
+//+kubebuilder:printcolumn:name="Expires",type=date,JSONPath=`.status.notAfter`
+//+kubebuilder:printcolumn:name="Revoked",type=boolean,JSONPath=`.status.revoked`
+
+// RedisClientCertificate is the Schema for the redisclientcertificates API
+type RedisClientCertificate struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   RedisClientCertificateSpec   `json:"spec,omitempty"`
+	Status RedisClientCertificateStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// RedisClientCertificateList contains a list of RedisClientCertificate
+type RedisClientCertificateList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []RedisClientCertificate `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&RedisClientCertificate{}, &RedisClientCertificateList{})
+}
@@ -0,0 +1,144 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// 运维操作类型
+// +kubebuilder:validation:Enum=Restart;BGSave;BGRewriteAOF;Failover;Flush;MemoryPurge;KillClients
+type OpsRequestType string
+
+const (
+	// 删除redis pod，由statefulset重建
+	OpsRequestRestart OpsRequestType = "Restart"
+	// 执行BGSAVE并等待快照完成
+	OpsRequestBGSave OpsRequestType = "BGSave"
+	// 执行BGREWRITEAOF并等待重写完成
+	OpsRequestBGRewriteAOF OpsRequestType = "BGRewriteAOF"
+	// 将从节点提升为主节点
+	OpsRequestFailover OpsRequestType = "Failover"
+	// 清空指定DB或全部数据
+	OpsRequestFlush OpsRequestType = "Flush"
+	// 执行MEMORY PURGE释放内存碎片
+	OpsRequestMemoryPurge OpsRequestType = "MemoryPurge"
+	// 按条件断开客户端连接
+	OpsRequestKillClients OpsRequestType = "KillClients"
+)
+
+// 运维操作阶段
+type OpsRequestPhase string
+
+const (
+	OpsRequestPhasePending   OpsRequestPhase = "Pending"
+	OpsRequestPhaseRunning   OpsRequestPhase = "Running"
+	OpsRequestPhaseSucceeded OpsRequestPhase = "Succeeded"
+	OpsRequestPhaseFailed    OpsRequestPhase = "Failed"
+)
+
+// 清空数据参数
+type FlushOptions struct {
+	// 需要清空的DB，all为true时忽略
+	// +kubebuilder:default:=0
+	DB int32 `json:"db,omitempty"`
+	// 为true时执行FLUSHALL
+	All bool `json:"all,omitempty"`
+	// 为true时异步清空
+	Async bool `json:"async,omitempty"`
+}
+
+// 断开客户端参数，多个条件同时满足的客户端才会被断开
+type KillClientsOptions struct {
+	// 客户端类型，如normal、pubsub、replica
+	Type string `json:"type,omitempty"`
+	// ACL用户名
+	User string `json:"user,omitempty"`
+	// 客户端地址，格式为ip:port
+	Addr string `json:"addr,omitempty"`
+	// 空闲时间不少于该值的客户端，单位为秒
+	MinIdleSeconds int64 `json:"minIdleSeconds,omitempty"`
+}
+
+// 执行前需满足的条件
+type OpsPreconditions struct {
+	// 为true时要求redis的Healthy状态为True
+	RequireHealthy bool `json:"requireHealthy,omitempty"`
+	// 要求redis当前角色，master或slave
+	// +kubebuilder:validation:Enum=master;slave
+	Role string `json:"role,omitempty"`
+}
+
+// RedisOpsRequestSpec defines the desired state of RedisOpsRequest
+type RedisOpsRequestSpec struct {
+	// 目标redis实例名称，需与运维对象处于同一namespace
+	RedisName string         `json:"redisName"`
+	Type      OpsRequestType `json:"type"`
+	// Flush操作参数
+	Flush *FlushOptions `json:"flush,omitempty"`
+	// KillClients操作参数
+	KillClients   *KillClientsOptions `json:"killClients,omitempty"`
+	Preconditions *OpsPreconditions   `json:"preconditions,omitempty"`
+	// 执行超时时间，单位为秒
+	// +kubebuilder:default:=300
+	TimeoutSeconds *int32 `json:"timeoutSeconds,omitempty"`
+	// 执行结束后保留时间，超时后自动删除，未设置时不删除
+	TTLSecondsAfterFinished *int32 `json:"ttlSecondsAfterFinished,omitempty"`
+}
+
+// RedisOpsRequestStatus defines the observed state of RedisOpsRequest
+type RedisOpsRequestStatus struct {
+	Phase          OpsRequestPhase `json:"phase,omitempty"`
+	StartTime      *metav1.Time    `json:"startTime,omitempty"`
+	CompletionTime *metav1.Time    `json:"completionTime,omitempty"`
+	// 执行前的LASTSAVE时间戳，用于判断BGSave是否完成
+	LastSave int64 `json:"lastSave,omitempty"`
+	// 重启前的pod UID，用于判断Restart是否完成
+	PodUID string `json:"podUID,omitempty"`
+	// 命令执行结果
+	Output  string `json:"output,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="Redis",type=string,JSONPath=`.spec.redisName`
+//+kubebuilder:printcolumn:name="Type",type=string,JSONPath=`.spec.type`
+//+kubebuilder:printcolumn:name="Phase",type=string,JSONPath=`.status.phase`
+//+kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// RedisOpsRequest is the Schema for the redisopsrequests API
+type RedisOpsRequest struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   RedisOpsRequestSpec   `json:"spec,omitempty"`
+	Status RedisOpsRequestStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// RedisOpsRequestList contains a list of RedisOpsRequest
+type RedisOpsRequestList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []RedisOpsRequest `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&RedisOpsRequest{}, &RedisOpsRequestList{})
+}
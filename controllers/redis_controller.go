@@ -20,8 +20,10 @@ import (
 	"context"
 	"time"
 
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/log"
@@ -33,12 +35,22 @@ import (
 // RedisReconciler reconciles a Redis object
 type RedisReconciler struct {
 	client.Client
-	Scheme *runtime.Scheme
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
 }
 
 //+kubebuilder:rbac:groups=redis.superwongo.com,resources=redis,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=redis.superwongo.com,resources=redis/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=redis.superwongo.com,resources=redis/finalizers,verbs=update
+//+kubebuilder:rbac:groups=redis.superwongo.com,resources=redisbackups,verbs=get;list;watch;create
+//+kubebuilder:rbac:groups=core,resources=events,verbs=get;list;watch;create;patch
+//+kubebuilder:rbac:groups=core,resources=secrets,verbs=get;list;watch;create;update
+//+kubebuilder:rbac:groups=core,resources=pods,verbs=get;patch
+//+kubebuilder:rbac:groups=core,resources=configmaps,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=cert-manager.io,resources=certificates,verbs=get;list;watch;create;update
+//+kubebuilder:rbac:groups=policy,resources=poddisruptionbudgets,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=networking.k8s.io,resources=networkpolicies,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=monitoring.coreos.com,resources=servicemonitors;podmonitors;prometheusrules,verbs=get;list;watch;create;update;delete
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -58,34 +70,113 @@ func (r *RedisReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl
 	err := r.Client.Get(context.TODO(), req.NamespacedName, instance)
 	if err != nil {
 		if errors.IsNotFound(err) {
+			k8sutils.ForgetRedisInstance(req.Namespace, req.Name)
 			return ctrl.Result{}, nil
 		}
 		return ctrl.Result{}, err
 	}
 	// 移除finalizer处理
-	if err := k8sutils.HandlerRedisFinalizer(instance, r.Client); err != nil {
+	start := time.Now()
+	err = k8sutils.HandlerRedisFinalizer(instance, r.Client)
+	k8sutils.ObserveReconcilePhase("finalizer", start, err)
+	if err != nil {
 		return ctrl.Result{}, nil
 	}
 	// 添加finalizer处理
 	if err := k8sutils.AddRedisFinalizer(instance, r.Client); err != nil {
 		return ctrl.Result{}, nil
 	}
+	// 暂停或维护期间不修改受管对象，仅更新状态
+	if err := k8sutils.UpdateRedisPausedCondition(instance, r.Client); err != nil {
+		return ctrl.Result{}, err
+	}
+	// 维护模式需同步到pod，暂停期间同样执行
+	if err := k8sutils.SyncRedisMaintenanceAnnotation(instance); err != nil {
+		return ctrl.Result{}, err
+	}
+	if k8sutils.IsRedisPaused(instance) {
+		k8sutils.RecordRedisInstance(instance.Namespace, instance.Name, "standalone", k8sutils.GetStandaloneRedisPhase(instance))
+		if err := r.updateRedisStatus(instance); err != nil {
+			return ctrl.Result{}, err
+		}
+		reqLogger.Info("Redis reconciliation is paused, will check again in 10 seconds")
+		return ctrl.Result{RequeueAfter: time.Second * 10}, nil
+	}
 	// 创建redis单体实例
-	err = k8sutils.CreateStandaloneRedis(instance)
+	start = time.Now()
+	err = k8sutils.CreateStandaloneRedis(instance, r.Client)
+	k8sutils.ObserveReconcilePhase("statefulset", start, err)
 	if err != nil {
+		// 等待证书等依赖资源就绪
+		if k8sutils.IsResourceNotReady(err) {
+			k8sutils.RecordRedisInstance(instance.Namespace, instance.Name, "standalone", k8sutils.RedisPhasePending)
+			return ctrl.Result{RequeueAfter: time.Second * 5}, nil
+		}
+		k8sutils.RecordRedisInstance(instance.Namespace, instance.Name, "standalone", k8sutils.RedisPhaseFailed)
+		r.Recorder.Event(instance, corev1.EventTypeWarning, "ReconcileFailed", err.Error())
 		return ctrl.Result{}, nil
 	}
+	k8sutils.RecordRedisInstance(instance.Namespace, instance.Name, "standalone", k8sutils.GetStandaloneRedisPhase(instance))
 	// 创建redis service
+	start = time.Now()
 	err = k8sutils.CreateStandaloneService(instance)
+	k8sutils.ObserveReconcilePhase("service", start, err)
 	if err != nil {
 		return ctrl.Result{}, nil
 	}
+	// 创建或删除exporter监控对象
+	if err := k8sutils.ReconcileRedisMonitor(instance); err != nil {
+		return ctrl.Result{}, err
+	}
+	// 创建或删除告警规则
+	if err := k8sutils.ReconcileRedisAlerts(instance); err != nil {
+		return ctrl.Result{}, err
+	}
+	// 创建或删除redis PodDisruptionBudget
+	if err := k8sutils.ReconcileStandalonePodDisruptionBudget(instance); err != nil {
+		return ctrl.Result{}, err
+	}
+	// 创建或删除redis NetworkPolicy
+	if err := k8sutils.ReconcileStandaloneNetworkPolicy(instance); err != nil {
+		return ctrl.Result{}, err
+	}
+	// 更新redis状态
+	if err := r.updateRedisStatus(instance); err != nil {
+		return ctrl.Result{}, err
+	}
+	// 同步外部redis迁移状态
+	if err := k8sutils.ReconcileRedisMigration(instance, r.Client); err != nil {
+		return ctrl.Result{}, err
+	}
 	reqLogger.Info("Will reconcile redis operator in again 10 seconds")
 	return ctrl.Result{RequeueAfter: time.Second * 10}, nil
 }
 
+// 更新redis状态，不修改受管对象
+func (r *RedisReconciler) updateRedisStatus(instance *redisv1alpha1.Redis) error {
+	// 更新数据恢复状态
+	if err := k8sutils.UpdateRedisRestoreCondition(instance, r.Client); err != nil {
+		return err
+	}
+	// 检查maxmemory配置
+	if err := k8sutils.UpdateRedisMaxMemoryCondition(instance, r.Client); err != nil {
+		return err
+	}
+	// 更新节点调优状态
+	if err := k8sutils.UpdateRedisNodeTuningCondition(instance, r.Client); err != nil {
+		return err
+	}
+	// 更新已加载模块
+	if err := k8sutils.UpdateRedisModuleStatus(instance, r.Client); err != nil {
+		return err
+	}
+	// 检查redis运行状态
+	return k8sutils.UpdateRedisHealthStatus(instance, r.Client)
+}
+
 // SetupWithManager sets up the controller with the Manager.
 func (r *RedisReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	k8sutils.SetEventRecorder(r.Recorder)
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&redisv1alpha1.Redis{}).
 		Complete(r)
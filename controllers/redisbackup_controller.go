@@ -0,0 +1,198 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	redisv1alpha1 "github.com/superwongo/redis-operator/api/v1alpha1"
+	"github.com/superwongo/redis-operator/k8sutils"
+)
+
+// RedisBackupReconciler reconciles a RedisBackup object
+type RedisBackupReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+}
+
+//+kubebuilder:rbac:groups=redis.superwongo.com,resources=redisbackups,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=redis.superwongo.com,resources=redisbackups/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=redis.superwongo.com,resources=redisbackups/finalizers,verbs=update
+//+kubebuilder:rbac:groups=batch,resources=jobs,verbs=get;list;watch;create;delete
+//+kubebuilder:rbac:groups=core,resources=pods;secrets,verbs=get;list;watch
+
+// Reconcile 按阶段推进备份：执行BGSAVE，等待LASTSAVE更新，上传快照，记录结果
+func (r *RedisBackupReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	reqLogger := log.FromContext(ctx)
+	reqLogger.Info("开始协调redis备份controller")
+
+	backup := &redisv1alpha1.RedisBackup{}
+	err := r.Client.Get(context.TODO(), req.NamespacedName, backup)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return ctrl.Result{}, nil
+		}
+		return ctrl.Result{}, err
+	}
+	// 备份被删除时清理备份文件
+	if backup.GetDeletionTimestamp() != nil {
+		return r.finalizeBackup(backup)
+	}
+	if !controllerutil.ContainsFinalizer(backup, k8sutils.RedisBackupFinalizer) {
+		controllerutil.AddFinalizer(backup, k8sutils.RedisBackupFinalizer)
+		if err := r.Client.Update(context.TODO(), backup); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	switch backup.Status.Phase {
+	case redisv1alpha1.BackupPhaseSucceeded, redisv1alpha1.BackupPhaseFailed:
+		return ctrl.Result{}, nil
+	}
+
+	instance := &redisv1alpha1.Redis{}
+	err = r.Client.Get(context.TODO(), types.NamespacedName{Namespace: backup.Namespace, Name: backup.Spec.RedisName}, instance)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return r.failBackup(backup, "redis "+backup.Spec.RedisName+" not found")
+		}
+		return ctrl.Result{}, err
+	}
+	if err := k8sutils.ValidateRedisBackup(instance, backup); err != nil {
+		return r.failBackup(backup, err.Error())
+	}
+
+	switch backup.Status.Phase {
+	case "", redisv1alpha1.BackupPhasePending:
+		// 维护期间不开始备份
+		if k8sutils.IsRedisInMaintenance(instance) {
+			reqLogger.Info("Redis is in maintenance, backup is deferred", "redis", instance.Name)
+			return ctrl.Result{RequeueAfter: time.Second * 30}, nil
+		}
+		// 记录当前LASTSAVE后执行BGSAVE
+		lastSave, version, err := k8sutils.StartRedisBackupSave(instance)
+		if err != nil {
+			reqLogger.Error(err, "Unable to trigger BGSAVE, will retry")
+			return ctrl.Result{RequeueAfter: time.Second * 10}, nil
+		}
+		now := metav1.Now()
+		backup.Status.Phase = redisv1alpha1.BackupPhaseSaving
+		backup.Status.StartTime = &now
+		backup.Status.LastSave = lastSave
+		backup.Status.RedisVersion = version
+		backup.Status.Location = k8sutils.GetBackupLocation(backup)
+		return ctrl.Result{RequeueAfter: time.Second * 2}, r.Client.Status().Update(context.TODO(), backup)
+	case redisv1alpha1.BackupPhaseSaving:
+		saved, err := k8sutils.IsRedisBackupSaved(instance, backup.Status.LastSave)
+		if k8sutils.IsBackupSaveFailed(err) {
+			return r.failBackup(backup, err.Error())
+		}
+		if err != nil || !saved {
+			// 连接中断、pod重启等错误可恢复，超时前继续等待
+			if timeout := k8sutils.GetBackupSaveTimeout(backup); backup.Status.StartTime != nil && time.Since(backup.Status.StartTime.Time) > timeout {
+				message := "BGSAVE did not complete within " + timeout.String()
+				if err != nil {
+					message += ": " + err.Error()
+				}
+				return r.failBackup(backup, message)
+			}
+			if err != nil {
+				reqLogger.Info("Unable to check BGSAVE progress, will retry", "reason", err.Error())
+			}
+			return ctrl.Result{RequeueAfter: time.Second * 2}, nil
+		}
+		if err := k8sutils.CreateRedisBackupJob(instance, backup); err != nil {
+			return ctrl.Result{}, err
+		}
+		backup.Status.Phase = redisv1alpha1.BackupPhaseUploading
+		return ctrl.Result{RequeueAfter: time.Second * 5}, r.Client.Status().Update(context.TODO(), backup)
+	case redisv1alpha1.BackupPhaseUploading:
+		result, done, err := k8sutils.GetRedisBackupJobResult(backup, false)
+		if err != nil {
+			if done {
+				return r.failBackup(backup, err.Error())
+			}
+			return ctrl.Result{}, err
+		}
+		if !done {
+			return ctrl.Result{RequeueAfter: time.Second * 5}, nil
+		}
+		now := metav1.Now()
+		backup.Status.Phase = redisv1alpha1.BackupPhaseSucceeded
+		backup.Status.CompletionTime = &now
+		backup.Status.Size = result.Size
+		backup.Status.Checksum = result.Checksum
+		backup.Status.Message = ""
+		reqLogger.Info("Redis backup completed", "location", backup.Status.Location, "size", result.Size)
+		k8sutils.RecordBackupResult(backup.Namespace, backup.Spec.RedisName, true)
+		return ctrl.Result{}, r.Client.Status().Update(context.TODO(), backup)
+	}
+	return ctrl.Result{}, nil
+}
+
+// 标记备份失败
+func (r *RedisBackupReconciler) failBackup(backup *redisv1alpha1.RedisBackup, message string) (ctrl.Result, error) {
+	now := metav1.Now()
+	backup.Status.Phase = redisv1alpha1.BackupPhaseFailed
+	backup.Status.CompletionTime = &now
+	backup.Status.Message = message
+	k8sutils.RecordBackupResult(backup.Namespace, backup.Spec.RedisName, false)
+	return ctrl.Result{}, r.Client.Status().Update(context.TODO(), backup)
+}
+
+// 删除备份文件后移除finalizer，未上传成功的备份无需清理
+func (r *RedisBackupReconciler) finalizeBackup(backup *redisv1alpha1.RedisBackup) (ctrl.Result, error) {
+	if !controllerutil.ContainsFinalizer(backup, k8sutils.RedisBackupFinalizer) {
+		return ctrl.Result{}, nil
+	}
+	if backup.Status.Phase == redisv1alpha1.BackupPhaseSucceeded {
+		if err := k8sutils.CreateRedisBackupCleanupJob(backup); err != nil {
+			return ctrl.Result{}, err
+		}
+		_, done, err := k8sutils.GetRedisBackupJobResult(backup, true)
+		if err != nil && !done {
+			return ctrl.Result{}, err
+		}
+		if !done {
+			return ctrl.Result{RequeueAfter: time.Second * 5}, nil
+		}
+		if err != nil {
+			log.Log.Error(err, "Unable to remove backup file, it may need to be deleted manually", "location", backup.Status.Location)
+		}
+	}
+	controllerutil.RemoveFinalizer(backup, k8sutils.RedisBackupFinalizer)
+	return ctrl.Result{}, r.Client.Update(context.TODO(), backup)
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *RedisBackupReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&redisv1alpha1.RedisBackup{}).
+		Owns(&batchv1.Job{}).
+		Complete(r)
+}
@@ -0,0 +1,190 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	redisv1alpha1 "github.com/superwongo/redis-operator/api/v1alpha1"
+)
+
+const backupScheduleLabel = "redis.superwongo.com/backup-schedule"
+
+// RedisBackupScheduleReconciler reconciles a RedisBackupSchedule object
+type RedisBackupScheduleReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+}
+
+//+kubebuilder:rbac:groups=redis.superwongo.com,resources=redisbackupschedules,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=redis.superwongo.com,resources=redisbackupschedules/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=redis.superwongo.com,resources=redisbackupschedules/finalizers,verbs=update
+
+// Reconcile 按cron表达式创建RedisBackup，并按保留策略清理已完成的备份
+func (r *RedisBackupScheduleReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	reqLogger := log.FromContext(ctx)
+	reqLogger.Info("开始协调redis定时备份controller")
+
+	schedule := &redisv1alpha1.RedisBackupSchedule{}
+	err := r.Client.Get(context.TODO(), req.NamespacedName, schedule)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return ctrl.Result{}, nil
+		}
+		return ctrl.Result{}, err
+	}
+	sched, err := cron.ParseStandard(schedule.Spec.Schedule)
+	if err != nil {
+		reqLogger.Error(err, "Invalid cron expression in redis backup schedule", "schedule", schedule.Spec.Schedule)
+		return ctrl.Result{}, nil
+	}
+
+	backups := &redisv1alpha1.RedisBackupList{}
+	if err := r.Client.List(context.TODO(), backups, client.InNamespace(schedule.Namespace), client.MatchingLabels{backupScheduleLabel: schedule.Name}); err != nil {
+		return ctrl.Result{}, err
+	}
+	if err := r.pruneBackups(schedule, backups.Items); err != nil {
+		return ctrl.Result{}, err
+	}
+	r.updateLastSuccessfulBackup(schedule, backups.Items)
+
+	// 以上次调度时间为起点计算下一次备份时间，错过的调度只补一次
+	now := time.Now()
+	last := schedule.CreationTimestamp.Time
+	if schedule.Status.LastScheduleTime != nil {
+		last = schedule.Status.LastScheduleTime.Time
+	}
+	next := sched.Next(last)
+	if !schedule.Spec.Suspend && !next.After(now) {
+		backup := generateScheduledBackup(schedule, now)
+		if err := controllerutil.SetControllerReference(schedule, backup, r.Scheme); err != nil {
+			return ctrl.Result{}, err
+		}
+		if err := r.Client.Create(context.TODO(), backup); err != nil && !errors.IsAlreadyExists(err) {
+			reqLogger.Error(err, "Unable to create scheduled redis backup")
+			return ctrl.Result{}, err
+		}
+		reqLogger.Info("Scheduled redis backup created", "backup", backup.Name)
+		scheduleTime := metav1.NewTime(now)
+		schedule.Status.LastScheduleTime = &scheduleTime
+		schedule.Status.LastBackup = backup.Name
+		next = sched.Next(now)
+	}
+	if err := r.Client.Status().Update(context.TODO(), schedule); err != nil {
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{RequeueAfter: next.Sub(now)}, nil
+}
+
+// 根据模板生成备份对象
+func generateScheduledBackup(schedule *redisv1alpha1.RedisBackupSchedule, scheduleTime time.Time) *redisv1alpha1.RedisBackup {
+	return &redisv1alpha1.RedisBackup{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("%s-%d", schedule.Name, scheduleTime.Unix()),
+			Namespace: schedule.Namespace,
+			Labels: map[string]string{
+				backupScheduleLabel: schedule.Name,
+			},
+		},
+		Spec: *schedule.Spec.BackupTemplate.DeepCopy(),
+	}
+}
+
+// 按数量和时间清理已完成的备份，进行中的备份不会被清理
+func (r *RedisBackupScheduleReconciler) pruneBackups(schedule *redisv1alpha1.RedisBackupSchedule, backups []redisv1alpha1.RedisBackup) error {
+	retention := schedule.Spec.Retention
+	if retention == nil {
+		return nil
+	}
+	var succeeded, failed []redisv1alpha1.RedisBackup
+	for _, backup := range backups {
+		if backup.DeletionTimestamp != nil {
+			continue
+		}
+		switch backup.Status.Phase {
+		case redisv1alpha1.BackupPhaseSucceeded:
+			succeeded = append(succeeded, backup)
+		case redisv1alpha1.BackupPhaseFailed:
+			failed = append(failed, backup)
+		}
+	}
+	// 失败的备份单独计数，避免连续失败时清理掉所有成功的备份
+	if err := r.pruneExpiredBackups(succeeded, retention.MaxCount, retention.MaxAge); err != nil {
+		return err
+	}
+	return r.pruneExpiredBackups(failed, retention.MaxFailedCount, retention.MaxAge)
+}
+
+// 按创建时间倒序保留maxCount个备份，删除超出数量或超过maxAge的备份
+func (r *RedisBackupScheduleReconciler) pruneExpiredBackups(backups []redisv1alpha1.RedisBackup, maxCount *int32, maxAge *metav1.Duration) error {
+	// 按创建时间倒序，最新的备份排在前面
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[j].CreationTimestamp.Before(&backups[i].CreationTimestamp)
+	})
+	for i := range backups {
+		backup := &backups[i]
+		expired := maxCount != nil && i >= int(*maxCount)
+		if maxAge != nil && time.Since(backup.CreationTimestamp.Time) > maxAge.Duration {
+			expired = true
+		}
+		if !expired {
+			continue
+		}
+		log.Log.Info("Pruning redis backup by retention policy", "backup", backup.Name, "phase", backup.Status.Phase)
+		if err := r.Client.Delete(context.TODO(), backup); err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// 记录最近一次成功的备份
+func (r *RedisBackupScheduleReconciler) updateLastSuccessfulBackup(schedule *redisv1alpha1.RedisBackupSchedule, backups []redisv1alpha1.RedisBackup) {
+	var latest *redisv1alpha1.RedisBackup
+	for i := range backups {
+		backup := &backups[i]
+		if backup.Status.Phase != redisv1alpha1.BackupPhaseSucceeded {
+			continue
+		}
+		if latest == nil || latest.CreationTimestamp.Before(&backup.CreationTimestamp) {
+			latest = backup
+		}
+	}
+	if latest != nil {
+		schedule.Status.LastSuccessfulBackup = latest.Name
+	}
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *RedisBackupScheduleReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&redisv1alpha1.RedisBackupSchedule{}).
+		Owns(&redisv1alpha1.RedisBackup{}).
+		Complete(r)
+}
@@ -0,0 +1,170 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	redisv1alpha1 "github.com/superwongo/redis-operator/api/v1alpha1"
+	"github.com/superwongo/redis-operator/k8sutils"
+)
+
+// RedisClientCertificateReconciler reconciles a RedisClientCertificate object
+type RedisClientCertificateReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+}
+
+//+kubebuilder:rbac:groups=redis.superwongo.com,resources=redisclientcertificates,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=redis.superwongo.com,resources=redisclientcertificates/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=redis.superwongo.com,resources=redisclientcertificates/finalizers,verbs=update
+//+kubebuilder:rbac:groups=core,resources=secrets,verbs=get;list;watch;create;update;delete
+
+// Reconcile 使用redis实例的CA签发客户端证书，并将证书CN映射为ACL用户
+func (r *RedisClientCertificateReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	reqLogger := log.FromContext(ctx)
+	reqLogger.Info("开始协调redis客户端证书controller")
+
+	cc := &redisv1alpha1.RedisClientCertificate{}
+	err := r.Client.Get(context.TODO(), req.NamespacedName, cc)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return ctrl.Result{}, nil
+		}
+		return ctrl.Result{}, err
+	}
+
+	instance := &redisv1alpha1.Redis{}
+	namespace := cc.Spec.RedisNamespace
+	if namespace == "" {
+		namespace = cc.Namespace
+	}
+	err = r.Client.Get(context.TODO(), types.NamespacedName{Namespace: namespace, Name: cc.Spec.RedisName}, instance)
+	if err != nil && !errors.IsNotFound(err) {
+		return ctrl.Result{}, err
+	}
+	redisFound := err == nil
+	// 跨namespace签发需redis实例显式允许，未允许时不签发证书也不修改ACL用户
+	allowed := !redisFound || k8sutils.IsClientCertificateNamespaceAllowed(instance, cc.Namespace)
+	redisFound = redisFound && allowed
+
+	// 证书被删除时清理ACL用户，redis已不存在时无需清理
+	if cc.GetDeletionTimestamp() != nil {
+		if !controllerutil.ContainsFinalizer(cc, k8sutils.RedisClientCertificateFinalizer) {
+			return ctrl.Result{}, nil
+		}
+		if redisFound && cc.Status.ACLUser != "" {
+			if err := k8sutils.RemoveClientCertificateACL(instance, cc.Status.ACLUser); err != nil {
+				reqLogger.Error(err, "Unable to remove ACL user, will retry", "user", cc.Status.ACLUser)
+				return ctrl.Result{RequeueAfter: time.Second * 10}, nil
+			}
+		}
+		controllerutil.RemoveFinalizer(cc, k8sutils.RedisClientCertificateFinalizer)
+		return ctrl.Result{}, r.Client.Update(context.TODO(), cc)
+	}
+	if !controllerutil.ContainsFinalizer(cc, k8sutils.RedisClientCertificateFinalizer) {
+		controllerutil.AddFinalizer(cc, k8sutils.RedisClientCertificateFinalizer)
+		if err := r.Client.Update(context.TODO(), cc); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+	if !allowed {
+		return r.updateStatus(cc, "namespace "+cc.Namespace+" is not allowed in spec.clientCertificateNamespaces of redis "+cc.Spec.RedisName, time.Minute)
+	}
+	if !redisFound {
+		return r.updateStatus(cc, "redis "+cc.Spec.RedisName+" not found", time.Minute)
+	}
+
+	if cc.Spec.Revoked {
+		if cc.Status.ACLUser != "" {
+			if err := k8sutils.RemoveClientCertificateACL(instance, cc.Status.ACLUser); err != nil {
+				return r.updateStatus(cc, "unable to remove ACL user: "+err.Error(), time.Second*10)
+			}
+			reqLogger.Info("Redis client certificate revoked", "user", cc.Status.ACLUser)
+			cc.Status.ACLUser = ""
+		}
+		// 删除证书secret，取消吊销时重新签发新证书
+		if err := k8sutils.DeleteClientCertificateSecret(cc); err != nil {
+			return r.updateStatus(cc, "unable to delete certificate secret: "+err.Error(), time.Second*10)
+		}
+		cc.Status.SerialNumber = ""
+		cc.Status.NotBefore = nil
+		cc.Status.NotAfter = nil
+		cc.Status.Revoked = true
+		return r.updateStatus(cc, "", 0)
+	}
+	cc.Status.Revoked = false
+	// 证书CN通过tls-auth-clients-user映射为ACL用户，实例不支持时拒绝
+	if cc.Spec.ACLUser != nil {
+		if err := k8sutils.ValidateClientCertificateACLSupport(instance); err != nil {
+			return r.updateStatus(cc, err.Error(), time.Minute)
+		}
+	}
+
+	cert, err := k8sutils.ReconcileClientCertificate(instance, cc)
+	if err != nil {
+		return r.updateStatus(cc, err.Error(), time.Minute)
+	}
+	notBefore, notAfter := metav1.NewTime(cert.NotBefore), metav1.NewTime(cert.NotAfter)
+	cc.Status.SerialNumber = cert.SerialNumber.Text(16)
+	cc.Status.NotBefore = &notBefore
+	cc.Status.NotAfter = &notAfter
+
+	user := k8sutils.GetClientCertificateCommonName(cc)
+	if cc.Status.ACLUser != "" && (cc.Spec.ACLUser == nil || cc.Status.ACLUser != user) {
+		if err := k8sutils.RemoveClientCertificateACL(instance, cc.Status.ACLUser); err != nil {
+			return r.updateStatus(cc, "unable to remove ACL user: "+err.Error(), time.Second*10)
+		}
+		cc.Status.ACLUser = ""
+	}
+	if cc.Spec.ACLUser != nil {
+		// redis重启后ACL用户丢失，定期重新下发
+		if err := k8sutils.ApplyClientCertificateACL(instance, user, cc.Spec.ACLUser.Rules); err != nil {
+			return r.updateStatus(cc, "unable to apply ACL user: "+err.Error(), time.Second*10)
+		}
+		cc.Status.ACLUser = user
+	}
+	return r.updateStatus(cc, "", time.Minute)
+}
+
+// 更新证书状态后按间隔重新协调，用于到期轮换及ACL重新下发
+func (r *RedisClientCertificateReconciler) updateStatus(cc *redisv1alpha1.RedisClientCertificate, message string, requeueAfter time.Duration) (ctrl.Result, error) {
+	cc.Status.Message = message
+	if err := r.Client.Status().Update(context.TODO(), cc); err != nil {
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{RequeueAfter: requeueAfter}, nil
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *RedisClientCertificateReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&redisv1alpha1.RedisClientCertificate{}).
+		Owns(&corev1.Secret{}).
+		Complete(r)
+}
@@ -0,0 +1,163 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	redisv1alpha1 "github.com/superwongo/redis-operator/api/v1alpha1"
+	"github.com/superwongo/redis-operator/k8sutils"
+)
+
+// RedisOpsRequestReconciler reconciles a RedisOpsRequest object
+type RedisOpsRequestReconciler struct {
+	client.Client
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
+}
+
+//+kubebuilder:rbac:groups=redis.superwongo.com,resources=redisopsrequests,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=redis.superwongo.com,resources=redisopsrequests/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=redis.superwongo.com,resources=redisopsrequests/finalizers,verbs=update
+//+kubebuilder:rbac:groups=core,resources=pods,verbs=get;list;watch;delete
+//+kubebuilder:rbac:groups=core,resources=secrets,verbs=get;list;watch
+
+// Reconcile 执行一次运维操作，跟踪完成情况并记录结果，结束后按TTL清理
+func (r *RedisOpsRequestReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	reqLogger := log.FromContext(ctx)
+	reqLogger.Info("开始协调redis运维操作controller")
+
+	ops := &redisv1alpha1.RedisOpsRequest{}
+	err := r.Client.Get(context.TODO(), req.NamespacedName, ops)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return ctrl.Result{}, nil
+		}
+		return ctrl.Result{}, err
+	}
+
+	switch ops.Status.Phase {
+	case redisv1alpha1.OpsRequestPhaseSucceeded, redisv1alpha1.OpsRequestPhaseFailed:
+		return r.cleanupOpsRequest(ops)
+	}
+
+	instance := &redisv1alpha1.Redis{}
+	err = r.Client.Get(context.TODO(), types.NamespacedName{Namespace: ops.Namespace, Name: ops.Spec.RedisName}, instance)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return r.finishOpsRequest(ops, "redis "+ops.Spec.RedisName+" not found")
+		}
+		return ctrl.Result{}, err
+	}
+
+	switch ops.Status.Phase {
+	case "", redisv1alpha1.OpsRequestPhasePending:
+		if err := k8sutils.ValidateRedisOpsRequest(instance, ops); err != nil {
+			return r.finishOpsRequest(ops, err.Error())
+		}
+		if err := k8sutils.PrepareRedisOpsRequest(instance, ops); err != nil {
+			return r.finishOpsRequest(ops, err.Error())
+		}
+		// 先持久化Running状态再执行，更新冲突时不执行，避免重复协调时操作被执行多次
+		now := metav1.Now()
+		ops.Status.StartTime = &now
+		ops.Status.Phase = redisv1alpha1.OpsRequestPhaseRunning
+		if err := r.Client.Status().Update(context.TODO(), ops); err != nil {
+			return ctrl.Result{}, err
+		}
+		done, err := k8sutils.StartRedisOpsRequest(instance, ops)
+		if err != nil {
+			return r.finishOpsRequest(ops, err.Error())
+		}
+		if done {
+			return r.finishOpsRequest(ops, "")
+		}
+		return ctrl.Result{RequeueAfter: time.Second * 2}, nil
+	case redisv1alpha1.OpsRequestPhaseRunning:
+		done, err := k8sutils.CheckRedisOpsRequest(instance, ops)
+		if err != nil {
+			return r.finishOpsRequest(ops, err.Error())
+		}
+		if done {
+			return r.finishOpsRequest(ops, "")
+		}
+		if timeout := getOpsRequestTimeout(ops); ops.Status.StartTime != nil && time.Since(ops.Status.StartTime.Time) > timeout {
+			return r.finishOpsRequest(ops, "timed out after "+timeout.String())
+		}
+		return ctrl.Result{RequeueAfter: time.Second * 2}, nil
+	}
+	return ctrl.Result{}, nil
+}
+
+// 获取执行超时时间
+func getOpsRequestTimeout(ops *redisv1alpha1.RedisOpsRequest) time.Duration {
+	if ops.Spec.TimeoutSeconds == nil {
+		return 5 * time.Minute
+	}
+	return time.Duration(*ops.Spec.TimeoutSeconds) * time.Second
+}
+
+// 记录执行结果，message为空时表示成功
+func (r *RedisOpsRequestReconciler) finishOpsRequest(ops *redisv1alpha1.RedisOpsRequest, message string) (ctrl.Result, error) {
+	now := metav1.Now()
+	ops.Status.CompletionTime = &now
+	ops.Status.Message = message
+	if message == "" {
+		ops.Status.Phase = redisv1alpha1.OpsRequestPhaseSucceeded
+		r.Recorder.Eventf(ops, corev1.EventTypeNormal, "Succeeded", "%s on redis %s succeeded", ops.Spec.Type, ops.Spec.RedisName)
+	} else {
+		ops.Status.Phase = redisv1alpha1.OpsRequestPhaseFailed
+		r.Recorder.Eventf(ops, corev1.EventTypeWarning, "Failed", "%s on redis %s failed: %s", ops.Spec.Type, ops.Spec.RedisName, message)
+	}
+	if err := r.Client.Status().Update(context.TODO(), ops); err != nil {
+		return ctrl.Result{}, err
+	}
+	return r.cleanupOpsRequest(ops)
+}
+
+// 执行结束超过TTL后删除运维对象
+func (r *RedisOpsRequestReconciler) cleanupOpsRequest(ops *redisv1alpha1.RedisOpsRequest) (ctrl.Result, error) {
+	if ops.Spec.TTLSecondsAfterFinished == nil || ops.Status.CompletionTime == nil {
+		return ctrl.Result{}, nil
+	}
+	expireTime := ops.Status.CompletionTime.Add(time.Duration(*ops.Spec.TTLSecondsAfterFinished) * time.Second)
+	if remaining := time.Until(expireTime); remaining > 0 {
+		return ctrl.Result{RequeueAfter: remaining}, nil
+	}
+	if err := r.Client.Delete(context.TODO(), ops); err != nil && !errors.IsNotFound(err) {
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{}, nil
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *RedisOpsRequestReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&redisv1alpha1.RedisOpsRequest{}).
+		Complete(r)
+}
@@ -0,0 +1,170 @@
+package k8sutils
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	redisv1alpha1 "github.com/superwongo/redis-operator/api/v1alpha1"
+)
+
+var prometheusRuleGVR = schema.GroupVersionResource{Group: "monitoring.coreos.com", Version: "v1", Resource: "prometheusrules"}
+
+const (
+	defaultAlertFor                 = "5m"
+	defaultAlertMemoryUsagePercent  = 90
+	defaultAlertRejectedConnections = 0
+	defaultAlertEvictionsPerSecond  = 100
+)
+
+// 告警规则
+type redisAlertRule struct {
+	Name        string
+	Expr        string
+	Severity    string
+	Summary     string
+	Description string
+}
+
+// 获取int32阈值，未设置时使用默认值
+func getAlertThreshold(value *int32, defaultValue int32) int32 {
+	if value == nil {
+		return defaultValue
+	}
+	return *value
+}
+
+// 生成内置告警规则，指标按namespace及pod名称限定在当前实例
+func generateRedisAlertRules(cr *redisv1alpha1.Redis) []redisAlertRule {
+	alerts := cr.Spec.Alerts
+	selector := fmt.Sprintf(`namespace="%s",pod=~"%s-[0-9]+"`, cr.Namespace, cr.Name)
+	memoryPercent := getAlertThreshold(alerts.MemoryUsagePercent, defaultAlertMemoryUsagePercent)
+	rejected := getAlertThreshold(alerts.RejectedConnections, defaultAlertRejectedConnections)
+	evictions := getAlertThreshold(alerts.EvictionsPerSecond, defaultAlertEvictionsPerSecond)
+	return []redisAlertRule{
+		{
+			Name:        "RedisDown",
+			Expr:        fmt.Sprintf(`redis_up{%s} == 0`, selector),
+			Severity:    "critical",
+			Summary:     "Redis instance is down",
+			Description: "Redis {{ $labels.pod }} in namespace {{ $labels.namespace }} is not responding.",
+		},
+		{
+			Name:        "RedisMemoryNearMaxMemory",
+			Expr:        fmt.Sprintf(`redis_memory_used_bytes{%[1]s} / redis_memory_max_bytes{%[1]s} * 100 > %[2]d and redis_memory_max_bytes{%[1]s} > 0`, selector, memoryPercent),
+			Severity:    "warning",
+			Summary:     "Redis memory is close to maxmemory",
+			Description: fmt.Sprintf("Redis {{ $labels.pod }} uses {{ $value | humanize }}%% of maxmemory (threshold %d%%).", memoryPercent),
+		},
+		{
+			Name:        "RedisRejectedConnections",
+			Expr:        fmt.Sprintf(`increase(redis_rejected_connections_total{%s}[1m]) > %d`, selector, rejected),
+			Severity:    "warning",
+			Summary:     "Redis is rejecting connections",
+			Description: "Redis {{ $labels.pod }} rejected {{ $value }} connections in the last minute, maxclients may be reached.",
+		},
+		{
+			Name:        "RedisReplicationBroken",
+			Expr:        fmt.Sprintf(`redis_master_link_up{%s} == 0`, selector),
+			Severity:    "critical",
+			Summary:     "Redis replication link is down",
+			Description: "Redis replica {{ $labels.pod }} lost the connection to its master.",
+		},
+		{
+			Name:        "RedisHighEvictions",
+			Expr:        fmt.Sprintf(`rate(redis_evicted_keys_total{%s}[5m]) > %d`, selector, evictions),
+			Severity:    "warning",
+			Summary:     "Redis is evicting keys",
+			Description: "Redis {{ $labels.pod }} evicts {{ $value | humanize }} keys per second.",
+		},
+		{
+			Name:        "RedisRDBSaveFailed",
+			Expr:        fmt.Sprintf(`redis_rdb_last_bgsave_status{%s} == 0`, selector),
+			Severity:    "critical",
+			Summary:     "Redis RDB snapshot failed",
+			Description: "The last BGSAVE of Redis {{ $labels.pod }} failed.",
+		},
+		{
+			Name:        "RedisAOFWriteFailed",
+			Expr:        fmt.Sprintf(`redis_aof_last_bgrewrite_status{%[1]s} == 0 or redis_aof_last_write_status{%[1]s} == 0`, selector),
+			Severity:    "critical",
+			Summary:     "Redis AOF write or rewrite failed",
+			Description: "The last AOF write or rewrite of Redis {{ $labels.pod }} failed.",
+		},
+		{
+			Name:        "RedisClusterSlotsNotOK",
+			Expr:        fmt.Sprintf(`redis_cluster_state{%[1]s} == 0 or redis_cluster_slots_fail{%[1]s} > 0 or redis_cluster_slots_pfail{%[1]s} > 0`, selector),
+			Severity:    "critical",
+			Summary:     "Redis cluster slots are not OK",
+			Description: "Redis cluster reported by {{ $labels.pod }} has failing slots or is not in ok state.",
+		},
+	}
+}
+
+// 创建或更新PrometheusRule，未启用时删除
+func ReconcileRedisAlerts(cr *redisv1alpha1.Redis) error {
+	if cr.Spec.Alerts == nil || !cr.Spec.Alerts.Enabled {
+		return deleteUnstructured(prometheusRuleGVR, cr.Namespace, cr.Name)
+	}
+	_, err := createOrUpdateUnstructured(prometheusRuleGVR, generatePrometheusRuleDef(cr), monitorLogger(cr.Namespace, cr.Name))
+	return err
+}
+
+// 初始化PrometheusRule声明
+func generatePrometheusRuleDef(cr *redisv1alpha1.Redis) *unstructured.Unstructured {
+	alerts := cr.Spec.Alerts
+	disabled := map[string]bool{}
+	for _, name := range alerts.Disabled {
+		disabled[name] = true
+	}
+	duration := alerts.For
+	if duration == "" {
+		duration = defaultAlertFor
+	}
+	rules := []interface{}{}
+	for _, rule := range generateRedisAlertRules(cr) {
+		if disabled[rule.Name] {
+			continue
+		}
+		rules = append(rules, map[string]interface{}{
+			"alert": rule.Name,
+			"expr":  rule.Expr,
+			"for":   duration,
+			"labels": map[string]interface{}{
+				"severity":       rule.Severity,
+				"redis_instance": cr.Name,
+			},
+			"annotations": map[string]interface{}{
+				"summary":     rule.Summary,
+				"description": rule.Description,
+			},
+		})
+	}
+	labels := map[string]interface{}{}
+	for k, v := range getRedisLabels(cr.ObjectMeta.Name, "standalone", "standalone", cr.ObjectMeta.Labels) {
+		labels[k] = v
+	}
+	for k, v := range alerts.Labels {
+		labels[k] = v
+	}
+	rule := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": prometheusRuleGVR.GroupVersion().String(),
+		"kind":       "PrometheusRule",
+		"metadata": map[string]interface{}{
+			"name":      cr.Name,
+			"namespace": cr.Namespace,
+			"labels":    labels,
+		},
+		"spec": map[string]interface{}{
+			"groups": []interface{}{
+				map[string]interface{}{
+					"name":  cr.Namespace + "-" + cr.Name + "-redis",
+					"rules": rules,
+				},
+			},
+		},
+	}}
+	AddOwnerRefToObject(rule, redisAsOwner(cr))
+	return rule
+}
@@ -0,0 +1,380 @@
+package k8sutils
+
+import (
+	"context"
+	"encoding/json"
+	stderrors "errors"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	redisv1alpha1 "github.com/superwongo/redis-operator/api/v1alpha1"
+)
+
+const (
+	RedisBackupFinalizer string = "redisBackupFinalizer"
+
+	redisDataPath     = "/data"
+	redisRDBFile      = "dump.rdb"
+	backupMountPath   = "/backup"
+	defaultS3Image    = "minio/mc:RELEASE.2024-11-21T17-21-54Z"
+	defaultPVCImage   = "busybox:1.36.1"
+	backupLabel       = "redis.superwongo.com/backup"
+	backupJobBackoff  = int32(3)
+	backupTerminalLog = "/dev/termination-log"
+)
+
+// redis报告BGSAVE失败，与连接错误不同，重试无法恢复
+var ErrBackupSaveFailed = stderrors.New("redis BGSAVE failed, check redis logs for details")
+
+// 是否为BGSAVE失败的错误
+func IsBackupSaveFailed(err error) bool {
+	return stderrors.Is(err, ErrBackupSaveFailed)
+}
+
+// 获取等待BGSAVE完成的超时时间
+func GetBackupSaveTimeout(backup *redisv1alpha1.RedisBackup) time.Duration {
+	if backup.Spec.SaveTimeoutSeconds == nil {
+		return time.Hour
+	}
+	return time.Duration(*backup.Spec.SaveTimeoutSeconds) * time.Second
+}
+
+// 上传备份文件到对象存储，快照先复制到临时目录，避免上传过程中被新的BGSAVE覆盖
+const s3UploadScript = `set -e
+cp ${REDIS_DATA_PATH}/${REDIS_RDB_FILE} /tmp/backup.rdb
+SIZE=$(wc -c < /tmp/backup.rdb | tr -d ' ')
+CHECKSUM=$(sha256sum /tmp/backup.rdb | cut -d ' ' -f 1)
+mc alias set backup "${S3_ENDPOINT}" "${AWS_ACCESS_KEY_ID}" "${AWS_SECRET_ACCESS_KEY}" ${MC_FLAGS} > /dev/null
+mc cp ${MC_FLAGS} /tmp/backup.rdb "backup/${S3_BUCKET}/${BACKUP_KEY}"
+printf '{"size":%s,"checksum":"%s"}' "${SIZE}" "${CHECKSUM}" > ` + backupTerminalLog
+
+const s3CleanupScript = `set -e
+mc alias set backup "${S3_ENDPOINT}" "${AWS_ACCESS_KEY_ID}" "${AWS_SECRET_ACCESS_KEY}" ${MC_FLAGS} > /dev/null
+mc rm ${MC_FLAGS} "backup/${S3_BUCKET}/${BACKUP_KEY}" || true`
+
+// 复制备份文件到pvc
+const pvcUploadScript = `set -e
+mkdir -p "$(dirname ` + backupMountPath + `/${BACKUP_KEY})"
+cp ${REDIS_DATA_PATH}/${REDIS_RDB_FILE} "` + backupMountPath + `/${BACKUP_KEY}"
+SIZE=$(wc -c < "` + backupMountPath + `/${BACKUP_KEY}" | tr -d ' ')
+CHECKSUM=$(sha256sum "` + backupMountPath + `/${BACKUP_KEY}" | cut -d ' ' -f 1)
+printf '{"size":%s,"checksum":"%s"}' "${SIZE}" "${CHECKSUM}" > ` + backupTerminalLog
+
+const pvcCleanupScript = `rm -f "` + backupMountPath + `/${BACKUP_KEY}"`
+
+// 备份任务写入termination-log的结果
+type BackupResult struct {
+	Size     int64  `json:"size"`
+	Checksum string `json:"checksum"`
+}
+
+func backupLogger(namespace string, name string) logr.Logger {
+	reqLogger := log.Log.WithValues("Request.RedisBackup.Namespace", namespace, "Request.RedisBackup.Name", name)
+	return reqLogger
+}
+
+// 获取备份文件相对路径
+func getBackupKey(backup *redisv1alpha1.RedisBackup) string {
+	prefix := ""
+	if backup.Spec.Storage.S3 != nil {
+		prefix = backup.Spec.Storage.S3.Prefix
+	} else if backup.Spec.Storage.PVC != nil {
+		prefix = backup.Spec.Storage.PVC.Path
+	}
+	return strings.TrimPrefix(path.Join(prefix, backup.Namespace, backup.Spec.RedisName, backup.Name+".rdb"), "/")
+}
+
+// 获取备份文件地址
+func GetBackupLocation(backup *redisv1alpha1.RedisBackup) string {
+	if backup.Spec.Storage.S3 != nil {
+		return fmt.Sprintf("s3://%s/%s", backup.Spec.Storage.S3.Bucket, getBackupKey(backup))
+	}
+	if backup.Spec.Storage.PVC != nil {
+		return fmt.Sprintf("pvc://%s/%s", backup.Spec.Storage.PVC.ClaimName, getBackupKey(backup))
+	}
+	return ""
+}
+
+// 校验备份配置
+func ValidateRedisBackup(cr *redisv1alpha1.Redis, backup *redisv1alpha1.RedisBackup) error {
+	if cr.Spec.RedisStorage == nil {
+		return fmt.Errorf("redis %s has no persistent storage, dump.rdb cannot be backed up", cr.Name)
+	}
+	// dragonfly快照为.dfs格式，没有dump.rdb
+	if getRedisFlavor(cr) == redisv1alpha1.RedisFlavorDragonfly {
+		return fmt.Errorf("redis %s uses flavor dragonfly, backups are not supported", cr.Name)
+	}
+	s3, pvc := backup.Spec.Storage.S3, backup.Spec.Storage.PVC
+	if (s3 == nil) == (pvc == nil) {
+		return fmt.Errorf("exactly one of spec.storage.s3 and spec.storage.pvc must be set")
+	}
+	return nil
+}
+
+// 执行BGSAVE，返回执行前的LASTSAVE时间戳及redis版本
+func StartRedisBackupSave(cr *redisv1alpha1.Redis) (int64, string, error) {
+	logger := redisLogger(cr.Namespace, cr.Name)
+	client, err := configureRedisClient(cr, getRedisPodName(cr))
+	if err != nil {
+		return 0, "", err
+	}
+	defer client.Close()
+	ctx := context.TODO()
+	lastSave, err := client.LastSave(ctx).Result()
+	if err != nil {
+		logger.Error(err, "Redis LASTSAVE command failed")
+		return 0, "", err
+	}
+	info, err := client.Info(ctx, "server").Result()
+	if err != nil {
+		logger.Error(err, "Redis INFO command failed")
+		return 0, "", err
+	}
+	// 正在进行AOF重写时，SCHEDULE会在重写结束后执行BGSAVE
+	if err := client.Do(ctx, "BGSAVE", "SCHEDULE").Err(); err != nil && !strings.Contains(err.Error(), "already in progress") {
+		logger.Error(err, "Redis BGSAVE command failed")
+		return 0, "", err
+	}
+	logger.Info("Redis BGSAVE triggered for backup")
+	return lastSave, parseRedisInfo(info, "redis_version"), nil
+}
+
+// 检查BGSAVE是否已完成
+func IsRedisBackupSaved(cr *redisv1alpha1.Redis, lastSave int64) (bool, error) {
+	client, err := configureRedisClient(cr, getRedisPodName(cr))
+	if err != nil {
+		return false, err
+	}
+	defer client.Close()
+	ctx := context.TODO()
+	current, err := client.LastSave(ctx).Result()
+	if err != nil {
+		return false, err
+	}
+	if current > lastSave {
+		return true, nil
+	}
+	info, err := client.Info(ctx, "persistence").Result()
+	if err != nil {
+		return false, err
+	}
+	if parseRedisInfo(info, "rdb_bgsave_in_progress") == "0" && parseRedisInfo(info, "rdb_last_bgsave_status") == "err" {
+		return false, ErrBackupSaveFailed
+	}
+	return false, nil
+}
+
+// 创建上传备份文件的job，job需调度到redis pod所在节点以挂载数据卷
+func CreateRedisBackupJob(cr *redisv1alpha1.Redis, backup *redisv1alpha1.RedisBackup) error {
+	logger := backupLogger(backup.Namespace, backup.Name)
+	pod, err := generateK8sClient().CoreV1().Pods(cr.Namespace).Get(context.TODO(), getRedisPodName(cr), metav1.GetOptions{})
+	if err != nil {
+		logger.Error(err, "Error in getting redis pod for backup")
+		return err
+	}
+	job := generateBackupJobDef(backup, backupJobName(backup, false), false)
+	job.Spec.Template.Spec.NodeName = pod.Spec.NodeName
+	job.Spec.Template.Spec.Volumes = append(job.Spec.Template.Spec.Volumes, corev1.Volume{
+		Name: "data",
+		VolumeSource: corev1.VolumeSource{
+			PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+				ClaimName: cr.Name + "-" + getRedisPodName(cr),
+				ReadOnly:  true,
+			},
+		},
+	})
+	job.Spec.Template.Spec.Containers[0].VolumeMounts = append(job.Spec.Template.Spec.Containers[0].VolumeMounts, corev1.VolumeMount{
+		Name:      "data",
+		MountPath: redisDataPath,
+		ReadOnly:  true,
+	})
+	return createBackupJob(backup.Namespace, job)
+}
+
+// 创建删除备份文件的job
+func CreateRedisBackupCleanupJob(backup *redisv1alpha1.RedisBackup) error {
+	return createBackupJob(backup.Namespace, generateBackupJobDef(backup, backupJobName(backup, true), true))
+}
+
+func backupJobName(backup *redisv1alpha1.RedisBackup, cleanup bool) string {
+	if cleanup {
+		return backup.Name + "-cleanup"
+	}
+	return backup.Name + "-upload"
+}
+
+// 初始化备份job声明
+func generateBackupJobDef(backup *redisv1alpha1.RedisBackup, name string, cleanup bool) *batchv1.Job {
+	labels := map[string]string{
+		backupLabel: backup.Name,
+	}
+	backoffLimit := backupJobBackoff
+	container := corev1.Container{
+		Name:            "backup",
+		Image:           backup.Spec.Image,
+		ImagePullPolicy: backup.Spec.ImagePullPolicy,
+		Command:         []string{"/bin/sh", "-c"},
+		Env: []corev1.EnvVar{
+			{Name: "BACKUP_KEY", Value: getBackupKey(backup)},
+			{Name: "REDIS_DATA_PATH", Value: redisDataPath},
+			{Name: "REDIS_RDB_FILE", Value: redisRDBFile},
+		},
+	}
+	if backup.Spec.Resources != nil {
+		container.Resources = *backup.Spec.Resources
+	}
+	var volumes []corev1.Volume
+	if s3 := backup.Spec.Storage.S3; s3 != nil {
+		if container.Image == "" {
+			container.Image = defaultS3Image
+		}
+		script := s3UploadScript
+		if cleanup {
+			script = s3CleanupScript
+		}
+		container.Args = []string{script}
+		mcFlags := ""
+		if s3.Insecure {
+			mcFlags = "--insecure"
+		}
+		container.Env = append(container.Env,
+			corev1.EnvVar{Name: "S3_ENDPOINT", Value: s3.Endpoint},
+			corev1.EnvVar{Name: "S3_BUCKET", Value: s3.Bucket},
+			corev1.EnvVar{Name: "MC_FLAGS", Value: mcFlags},
+			corev1.EnvVar{Name: "MC_CONFIG_DIR", Value: "/tmp/.mc"},
+			generateSecretEnvVar("AWS_ACCESS_KEY_ID", s3.CredentialsSecret.Name),
+			generateSecretEnvVar("AWS_SECRET_ACCESS_KEY", s3.CredentialsSecret.Name),
+		)
+	} else if pvc := backup.Spec.Storage.PVC; pvc != nil {
+		if container.Image == "" {
+			container.Image = defaultPVCImage
+		}
+		script := pvcUploadScript
+		if cleanup {
+			script = pvcCleanupScript
+		}
+		container.Args = []string{script}
+		volumes = append(volumes, corev1.Volume{
+			Name: "backup",
+			VolumeSource: corev1.VolumeSource{
+				PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: pvc.ClaimName},
+			},
+		})
+		container.VolumeMounts = append(container.VolumeMounts, corev1.VolumeMount{Name: "backup", MountPath: backupMountPath})
+	}
+	job := &batchv1.Job{
+		TypeMeta:   generateMetaInformation("Job", "batch/v1"),
+		ObjectMeta: generateObjectMetaInformation(name, backup.Namespace, labels, map[string]string{}),
+		Spec: batchv1.JobSpec{
+			BackoffLimit: &backoffLimit,
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: labels},
+				Spec: corev1.PodSpec{
+					RestartPolicy: corev1.RestartPolicyNever,
+					Containers:    []corev1.Container{container},
+					Volumes:       volumes,
+				},
+			},
+		},
+	}
+	AddOwnerRefToObject(job, backupAsOwner(backup))
+	return job
+}
+
+// 从secret中读取与环境变量同名的key
+func generateSecretEnvVar(name string, secretName string) corev1.EnvVar {
+	return corev1.EnvVar{
+		Name: name,
+		ValueFrom: &corev1.EnvVarSource{
+			SecretKeyRef: &corev1.SecretKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{Name: secretName},
+				Key:                  name,
+			},
+		},
+	}
+}
+
+// 设置备份所属对象
+func backupAsOwner(backup *redisv1alpha1.RedisBackup) metav1.OwnerReference {
+	trueVar := true
+	return metav1.OwnerReference{
+		APIVersion: redisv1alpha1.GroupVersion.String(),
+		Kind:       "RedisBackup",
+		Name:       backup.Name,
+		UID:        backup.UID,
+		Controller: &trueVar,
+	}
+}
+
+func createBackupJob(namespace string, job *batchv1.Job) error {
+	logger := backupLogger(namespace, job.Name)
+	_, err := generateK8sClient().BatchV1().Jobs(namespace).Create(context.TODO(), job, metav1.CreateOptions{})
+	if err != nil && !errors.IsAlreadyExists(err) {
+		logger.Error(err, "Redis backup job creation failed")
+		return err
+	}
+	logger.Info("Redis backup job creation is successful")
+	return nil
+}
+
+// 查询备份job执行结果，job未结束时返回nil
+func GetRedisBackupJobResult(backup *redisv1alpha1.RedisBackup, cleanup bool) (*BackupResult, bool, error) {
+	logger := backupLogger(backup.Namespace, backup.Name)
+	name := backupJobName(backup, cleanup)
+	job, err := generateK8sClient().BatchV1().Jobs(backup.Namespace).Get(context.TODO(), name, metav1.GetOptions{})
+	if err != nil {
+		logger.Error(err, "Redis backup job get action failed")
+		return nil, false, err
+	}
+	for _, cond := range job.Status.Conditions {
+		if cond.Status != corev1.ConditionTrue {
+			continue
+		}
+		switch cond.Type {
+		case batchv1.JobFailed:
+			return nil, true, fmt.Errorf("backup job %s failed: %s", name, cond.Message)
+		case batchv1.JobComplete:
+			if cleanup {
+				return &BackupResult{}, true, nil
+			}
+			result, err := getBackupJobTerminationMessage(backup.Namespace, name)
+			return result, true, err
+		}
+	}
+	return nil, false, nil
+}
+
+// 读取备份任务写入termination-log的结果
+func getBackupJobTerminationMessage(namespace string, jobName string) (*BackupResult, error) {
+	pods, err := generateK8sClient().CoreV1().Pods(namespace).List(context.TODO(), metav1.ListOptions{
+		LabelSelector: "job-name=" + jobName,
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, pod := range pods.Items {
+		if pod.Status.Phase != corev1.PodSucceeded {
+			continue
+		}
+		for _, status := range pod.Status.ContainerStatuses {
+			if status.State.Terminated == nil {
+				continue
+			}
+			result := &BackupResult{}
+			if err := json.Unmarshal([]byte(status.State.Terminated.Message), result); err != nil {
+				return nil, fmt.Errorf("unable to parse backup job result: %v", err)
+			}
+			return result, nil
+		}
+	}
+	return nil, fmt.Errorf("no succeeded pod found for backup job %s", jobName)
+}
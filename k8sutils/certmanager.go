@@ -0,0 +1,156 @@
+package k8sutils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	redisv1alpha1 "github.com/superwongo/redis-operator/api/v1alpha1"
+)
+
+var certificateGVR = schema.GroupVersionResource{Group: "cert-manager.io", Version: "v1", Resource: "certificates"}
+
+// 依赖的资源尚未就绪，需稍后重新协调
+var ErrResourceNotReady = errors.New("dependent resource is not ready")
+
+// 是否为等待依赖资源就绪的错误
+func IsResourceNotReady(err error) bool {
+	return errors.Is(err, ErrResourceNotReady)
+}
+
+// 初始化cert-manager Certificate声明
+func generateCertificateDef(cr *redisv1alpha1.Redis, secretName string) *unstructured.Unstructured {
+	issuerRef := cr.Spec.TLS.IssuerRef
+	kind, group := issuerRef.Kind, issuerRef.Group
+	if kind == "" {
+		kind = "Issuer"
+	}
+	if group == "" {
+		group = certificateGVR.Group
+	}
+	dnsNames := []interface{}{}
+	for _, name := range getRedisTLSDNSNames(cr) {
+		dnsNames = append(dnsNames, name)
+	}
+	labels := map[string]interface{}{}
+	for k, v := range getRedisLabels(cr.ObjectMeta.Name, "standalone", "standalone", cr.ObjectMeta.Labels) {
+		labels[k] = v
+	}
+	certificate := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": certificateGVR.GroupVersion().String(),
+		"kind":       "Certificate",
+		"metadata": map[string]interface{}{
+			"name":      cr.Name,
+			"namespace": cr.Namespace,
+			"labels":    labels,
+		},
+		"spec": map[string]interface{}{
+			"secretName":  secretName,
+			"commonName":  cr.Name,
+			"dnsNames":    dnsNames,
+			"ipAddresses": []interface{}{"127.0.0.1"},
+			"usages":      []interface{}{"server auth", "client auth"},
+			"issuerRef": map[string]interface{}{
+				"name":  issuerRef.Name,
+				"kind":  kind,
+				"group": group,
+			},
+		},
+	}}
+	AddOwnerRefToObject(certificate, redisAsOwner(cr))
+	return certificate
+}
+
+// 创建或更新cert-manager Certificate，证书secret就绪后返回证书摘要
+func ReconcileRedisCertificate(cr *redisv1alpha1.Redis) (string, error) {
+	logger := tlsLogger(cr.Namespace, cr.Name)
+	secretName := getRedisTLSSpec(cr).Secret.SecretName
+	certificate := generateCertificateDef(cr, secretName)
+	certificates := generateK8sDynamicClient().Resource(certificateGVR).Namespace(cr.Namespace)
+	stored, err := certificates.Get(context.TODO(), cr.Name, metav1.GetOptions{})
+	switch {
+	case meta.IsNoMatchError(err) || (apierrors.IsNotFound(err) && isCRDMissing(err)):
+		return "", fmt.Errorf("cert-manager is not installed, Certificate CRD not found")
+	case apierrors.IsNotFound(err):
+		if stored, err = certificates.Create(context.TODO(), certificate, metav1.CreateOptions{}); err != nil {
+			logger.Error(err, "Redis certificate creation failed")
+			return "", err
+		}
+		logger.Info("Redis certificate creation was successful")
+	case err != nil:
+		return "", err
+	default:
+		storedSpec, _, _ := unstructured.NestedMap(stored.Object, "spec")
+		newSpec, _, _ := unstructured.NestedMap(certificate.Object, "spec")
+		if !equalUnstructured(storedSpec, newSpec) {
+			stored.Object["spec"] = newSpec
+			if stored, err = certificates.Update(context.TODO(), stored, metav1.UpdateOptions{}); err != nil {
+				logger.Error(err, "Redis certificate update failed")
+				return "", err
+			}
+			logger.Info("Redis certificate update successfully")
+		}
+	}
+	secret, err := generateK8sClient().CoreV1().Secrets(cr.Namespace).Get(context.TODO(), secretName, metav1.GetOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return "", err
+	}
+	// 仅首次签发时等待证书就绪，续签或issuer暂时不可用时继续使用已有证书
+	if err != nil || len(secret.Data[corev1.TLSCertKey]) == 0 {
+		logger.Info("Waiting for redis certificate to be issued")
+		return "", fmt.Errorf("certificate secret %s: %w", secretName, ErrResourceNotReady)
+	}
+	if !isCertificateReady(stored) {
+		message := getCertificateReadyMessage(stored)
+		logger.Info("Redis certificate is not ready, keep using the existing secret", "message", message)
+		recordEvent(cr, corev1.EventTypeWarning, EventReasonCertificateNotReady, "certificate %s is not ready, serving the existing certificate: %s", cr.Name, message)
+	}
+	return getCertificateHash(secret), nil
+}
+
+// CRD不存在时NotFound错误不包含资源名称
+func isCRDMissing(err error) bool {
+	status, ok := err.(apierrors.APIStatus)
+	return ok && (status.Status().Details == nil || status.Status().Details.Name == "")
+}
+
+// Certificate的Ready状态说明
+func getCertificateReadyMessage(certificate *unstructured.Unstructured) string {
+	conditions, _, _ := unstructured.NestedSlice(certificate.Object, "status", "conditions")
+	for _, item := range conditions {
+		condition, ok := item.(map[string]interface{})
+		if ok && condition["type"] == "Ready" {
+			return fmt.Sprint(condition["message"])
+		}
+	}
+	return "no Ready condition reported"
+}
+
+// Certificate的Ready状态为True
+func isCertificateReady(certificate *unstructured.Unstructured) bool {
+	conditions, _, _ := unstructured.NestedSlice(certificate.Object, "status", "conditions")
+	for _, item := range conditions {
+		condition, ok := item.(map[string]interface{})
+		if ok && condition["type"] == "Ready" && condition["status"] == "True" {
+			return true
+		}
+	}
+	return false
+}
+
+// 比较cert-manager补全默认值前后的spec
+func equalUnstructured(stored map[string]interface{}, desired map[string]interface{}) bool {
+	for k, v := range desired {
+		if fmt.Sprint(stored[k]) != fmt.Sprint(v) {
+			return false
+		}
+	}
+	return true
+}
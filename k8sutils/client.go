@@ -1,6 +1,7 @@
 package k8sutils
 
 import (
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
@@ -25,3 +26,15 @@ func generateK8sClient() *kubernetes.Clientset {
 	}
 	return clientset
 }
+
+func generateK8sDynamicClient() dynamic.Interface {
+	config, err := generateK8sConfig()
+	if err != nil {
+		panic(err.Error())
+	}
+	dynamicClient, err := dynamic.NewForConfig(config)
+	if err != nil {
+		panic(err.Error())
+	}
+	return dynamicClient
+}
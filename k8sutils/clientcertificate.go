@@ -0,0 +1,291 @@
+package k8sutils
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	redisv1alpha1 "github.com/superwongo/redis-operator/api/v1alpha1"
+)
+
+const (
+	RedisClientCertificateFinalizer = "redisClientCertificateFinalizer"
+)
+
+// 支持tls-auth-clients-user的最低valkey版本
+var tlsAuthClientsUserVersion = [3]int{9, 0, 0}
+
+// 获取签发客户端证书的CA，非autoTLS时从caSigningSecret读取，该secret不挂载到pod中，避免CA私钥泄露到redis容器
+func getRedisCA(cr *redisv1alpha1.Redis) (*x509.Certificate, crypto.Signer, []byte, error) {
+	if isAutoTLSEnabled(cr) {
+		return getOrCreateOperatorCA()
+	}
+	tlsSpec := getRedisTLSSpec(cr)
+	if tlsSpec == nil {
+		return nil, nil, nil, fmt.Errorf("TLS is not enabled for redis %s", cr.Name)
+	}
+	if tlsSpec.CASigningSecret == "" {
+		return nil, nil, nil, fmt.Errorf("spec.TLS.caSigningSecret is required to sign client certificates for redis %s", cr.Name)
+	}
+	if tlsSpec.CASigningSecret == tlsSpec.Secret.SecretName {
+		return nil, nil, nil, fmt.Errorf("spec.TLS.caSigningSecret must not be the secret mounted into redis pods")
+	}
+	secrets := generateK8sClient().CoreV1().Secrets(cr.Namespace)
+	signing, err := secrets.Get(context.TODO(), tlsSpec.CASigningSecret, metav1.GetOptions{})
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	ca, err := parseCertificate(signing.Data[caCertKey])
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	block, _ := pem.Decode(signing.Data[caPrivateKey])
+	if block == nil {
+		return nil, nil, nil, fmt.Errorf("secret %s has no %s, unable to sign client certificates", signing.Name, caPrivateKey)
+	}
+	var key interface{}
+	switch block.Type {
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	default:
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, nil, nil, fmt.Errorf("unsupported CA private key type in secret %s", signing.Name)
+	}
+	// 签发的证书需能通过redis的校验
+	mounted, err := secrets.Get(context.TODO(), tlsSpec.Secret.SecretName, metav1.GetOptions{})
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	caFile := caCertKey
+	if tlsSpec.CaKeyFile != "" {
+		caFile = tlsSpec.CaKeyFile
+	}
+	if !containsCertificate(mounted.Data[caFile], ca) {
+		return nil, nil, nil, fmt.Errorf("CA in secret %s is not trusted by redis %s", signing.Name, cr.Name)
+	}
+	return ca, signer, mounted.Data[caFile], nil
+}
+
+// PEM证书链中是否包含指定证书
+func containsCertificate(bundle []byte, cert *x509.Certificate) bool {
+	for {
+		var block *pem.Block
+		block, bundle = pem.Decode(bundle)
+		if block == nil {
+			return false
+		}
+		if block.Type == "CERTIFICATE" && bytes.Equal(block.Bytes, cert.Raw) {
+			return true
+		}
+	}
+}
+
+// 是否允许指定namespace中的RedisClientCertificate为该实例签发证书
+func IsClientCertificateNamespaceAllowed(cr *redisv1alpha1.Redis, namespace string) bool {
+	if namespace == cr.Namespace {
+		return true
+	}
+	for _, allowed := range cr.Spec.ClientCertificateNamespaces {
+		if allowed == namespace {
+			return true
+		}
+	}
+	return false
+}
+
+// 删除吊销证书对应的secret，仅删除由该证书创建的secret
+func DeleteClientCertificateSecret(cc *redisv1alpha1.RedisClientCertificate) error {
+	secrets := generateK8sClient().CoreV1().Secrets(cc.Namespace)
+	secret, err := secrets.Get(context.TODO(), cc.Spec.SecretName, metav1.GetOptions{})
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	if !isOwnedBy(secret, clientCertificateAsOwner(cc)) {
+		return nil
+	}
+	err = secrets.Delete(context.TODO(), secret.Name, metav1.DeleteOptions{Preconditions: &metav1.Preconditions{UID: &secret.UID}})
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+// 客户端证书CN
+func GetClientCertificateCommonName(cc *redisv1alpha1.RedisClientCertificate) string {
+	if cc.Spec.CommonName != "" {
+		return cc.Spec.CommonName
+	}
+	return cc.Name
+}
+
+// 签发或轮换客户端证书，返回当前生效的证书
+func ReconcileClientCertificate(cr *redisv1alpha1.Redis, cc *redisv1alpha1.RedisClientCertificate) (*x509.Certificate, error) {
+	logger := tlsLogger(cc.Namespace, cc.Spec.SecretName)
+	duration, renewBefore := defaultCertDuration, defaultCertRenewal
+	if cc.Spec.Duration != nil {
+		duration = cc.Spec.Duration.Duration
+	}
+	if cc.Spec.RenewBefore != nil {
+		renewBefore = cc.Spec.RenewBefore.Duration
+	}
+	if renewBefore >= duration {
+		return nil, fmt.Errorf("spec.renewBefore must be shorter than spec.duration")
+	}
+	ca, caKey, caPEM, err := getRedisCA(cr)
+	if err != nil {
+		return nil, err
+	}
+	commonName := GetClientCertificateCommonName(cc)
+	secrets := generateK8sClient().CoreV1().Secrets(cc.Namespace)
+	stored, err := secrets.Get(context.TODO(), cc.Spec.SecretName, metav1.GetOptions{})
+	if err != nil && !errors.IsNotFound(err) {
+		return nil, err
+	}
+	found := err == nil
+	if found && bytes.Equal(stored.Data[caCertKey], caPEM) {
+		if cert, err := parseCertificate(stored.Data[tlsCertKey]); err == nil &&
+			cert.Subject.CommonName == commonName && time.Until(cert.NotAfter) >= renewBefore {
+			return cert, nil
+		}
+	}
+	certPEM, keyPEM, err := issueCertificate(ca, caKey, commonName, nil, nil, []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}, duration)
+	if err != nil {
+		logger.Error(err, "Unable to issue redis client certificate")
+		return nil, err
+	}
+	secret := &corev1.Secret{
+		TypeMeta:   generateMetaInformation("Secret", "v1"),
+		ObjectMeta: metav1.ObjectMeta{Name: cc.Spec.SecretName, Namespace: cc.Namespace},
+		Type:       corev1.SecretTypeTLS,
+		Data:       map[string][]byte{caCertKey: caPEM, tlsCertKey: certPEM, tlsPrivateKey: keyPEM},
+	}
+	AddOwnerRefToObject(secret, clientCertificateAsOwner(cc))
+	if !found {
+		_, err = secrets.Create(context.TODO(), secret, metav1.CreateOptions{})
+	} else {
+		secret.ResourceVersion = stored.ResourceVersion
+		_, err = secrets.Update(context.TODO(), secret, metav1.UpdateOptions{})
+	}
+	if err != nil {
+		logger.Error(err, "Unable to save redis client certificate")
+		return nil, err
+	}
+	logger.Info("Redis client certificate issued", "commonName", commonName)
+	return parseCertificate(certPEM)
+}
+
+// 设置客户端证书所属对象
+func clientCertificateAsOwner(cc *redisv1alpha1.RedisClientCertificate) metav1.OwnerReference {
+	trueVar := true
+	return metav1.OwnerReference{
+		APIVersion: redisv1alpha1.GroupVersion.String(),
+		Kind:       "RedisClientCertificate",
+		Name:       cc.Name,
+		UID:        cc.UID,
+		Controller: &trueVar,
+	}
+}
+
+// 创建或更新证书CN对应的ACL用户，密码随机且不保存，通过tls-auth-clients-user CN以客户端证书认证
+func ApplyClientCertificateACL(cr *redisv1alpha1.Redis, user string, rules string) error {
+	rc, err := configureRedisClient(cr, getRedisPodName(cr))
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	password := make([]byte, 32)
+	if _, err := rand.Read(password); err != nil {
+		return err
+	}
+	ctx := context.TODO()
+	// 用户已存在时只更新权限，避免重置密码
+	existing, err := rc.Do(ctx, "ACL", "GETUSER", user).Result()
+	if err != nil && err != redis.Nil {
+		return err
+	}
+	args := []interface{}{"ACL", "SETUSER", user, "on"}
+	if existing == nil {
+		args = append(args, ">"+hex.EncodeToString(password))
+	}
+	args = append(args, "resetkeys", "resetchannels", "-@all")
+	for _, rule := range strings.Fields(rules) {
+		args = append(args, rule)
+	}
+	return rc.Do(ctx, args...).Err()
+}
+
+// 删除证书CN对应的ACL用户并断开其连接
+func RemoveClientCertificateACL(cr *redisv1alpha1.Redis, user string) error {
+	rc, err := configureRedisClient(cr, getRedisPodName(cr))
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	return rc.Do(context.TODO(), "ACL", "DELUSER", user).Err()
+}
+
+// 校验实例是否支持tls-auth-clients-user，不支持时证书CN无法映射为ACL用户
+func ValidateClientCertificateACLSupport(cr *redisv1alpha1.Redis) error {
+	if getRedisFlavor(cr) != redisv1alpha1.RedisFlavorValkey {
+		return fmt.Errorf("mapping client certificates to ACL users requires flavor valkey %s or later", formatVersion(tlsAuthClientsUserVersion))
+	}
+	version, ok := parseImageVersion(getRedisImage(cr))
+	if !ok && cr.Status.Health != nil {
+		version, ok = parseVersion(cr.Status.Health.Version)
+	}
+	if !ok {
+		return fmt.Errorf("unable to determine the valkey version of redis %s, mapping client certificates to ACL users requires %s or later", cr.Name, formatVersion(tlsAuthClientsUserVersion))
+	}
+	if compareVersion(version, tlsAuthClientsUserVersion) < 0 {
+		return fmt.Errorf("valkey %s does not support mapping client certificates to ACL users, %s or later is required", formatVersion(version), formatVersion(tlsAuthClientsUserVersion))
+	}
+	return nil
+}
+
+// 是否存在为该实例映射ACL用户的有效客户端证书，实例不支持时返回false
+func hasClientCertificateACLUsers(cr *redisv1alpha1.Redis, cl client.Client) (bool, error) {
+	if getRedisTLSSpec(cr) == nil || ValidateClientCertificateACLSupport(cr) != nil {
+		return false, nil
+	}
+	certificates := &redisv1alpha1.RedisClientCertificateList{}
+	if err := cl.List(context.TODO(), certificates); err != nil {
+		return false, err
+	}
+	for _, cc := range certificates.Items {
+		namespace := cc.Spec.RedisNamespace
+		if namespace == "" {
+			namespace = cc.Namespace
+		}
+		if cc.Spec.RedisName != cr.Name || namespace != cr.Namespace || cc.Spec.ACLUser == nil || cc.Spec.Revoked {
+			continue
+		}
+		if IsClientCertificateNamespaceAllowed(cr, cc.Namespace) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
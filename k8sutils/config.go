@@ -0,0 +1,232 @@
+package k8sutils
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/banzaicloud/k8s-objectmatcher/patch"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	redisv1alpha1 "github.com/superwongo/redis-operator/api/v1alpha1"
+)
+
+const (
+	// 镜像启动时会include该文件
+	redisAdditionalConfigKey = "redis-additional.conf"
+	// pod模板中记录配置摘要，配置变化时滚动重启
+	redisConfigHashAnnotation = "redis.superwongo.com/config-hash"
+)
+
+func configMapLogger(namespace string, name string) logr.Logger {
+	reqLogger := log.Log.WithValues("Request.ConfigMap.Namespace", namespace, "Request.ConfigMap.Name", name)
+	return reqLogger
+}
+
+// operator管理的redis配置configMap名称
+func getRedisConfigMapName(cr *redisv1alpha1.Redis) string {
+	return cr.Name + "-operator-config"
+}
+
+// 校验持久化方式与spec.storage是否匹配
+func validateRedisPersistence(cr *redisv1alpha1.Redis) error {
+	persistence := cr.Spec.Persistence
+	if persistence == nil {
+		return nil
+	}
+	switch persistence.Mode {
+	case redisv1alpha1.PersistenceModeNone:
+		if cr.Spec.RedisStorage != nil {
+			return fmt.Errorf("spec.storage must not be set when spec.persistence.mode is none")
+		}
+	case redisv1alpha1.PersistenceModeRDB, redisv1alpha1.PersistenceModeAOF, redisv1alpha1.PersistenceModeHybrid:
+		if cr.Spec.RedisStorage == nil {
+			return fmt.Errorf("spec.storage is required when spec.persistence.mode is %s", persistence.Mode)
+		}
+	default:
+		return fmt.Errorf("unknown persistence mode %q", persistence.Mode)
+	}
+	if persistence.Mode == redisv1alpha1.PersistenceModeRDB && persistence.AOF != nil {
+		return fmt.Errorf("spec.persistence.aof is not allowed when spec.persistence.mode is rdb")
+	}
+	if persistence.Mode == redisv1alpha1.PersistenceModeAOF && persistence.RDB != nil {
+		return fmt.Errorf("spec.persistence.rdb is not allowed when spec.persistence.mode is aof")
+	}
+	return nil
+}
+
+// 生成持久化相关配置
+func generatePersistenceConfig(persistence *redisv1alpha1.Persistence) []string {
+	// 先清空镜像默认的保存规则
+	lines := []string{`save ""`}
+	mode := persistence.Mode
+	if mode == redisv1alpha1.PersistenceModeRDB || mode == redisv1alpha1.PersistenceModeHybrid {
+		rules := []redisv1alpha1.RDBSaveRule{{Seconds: 3600, Changes: 1}, {Seconds: 300, Changes: 100}, {Seconds: 60, Changes: 10000}}
+		if persistence.RDB != nil && len(persistence.RDB.SaveRules) > 0 {
+			rules = persistence.RDB.SaveRules
+		}
+		for _, rule := range rules {
+			lines = append(lines, fmt.Sprintf("save %d %d", rule.Seconds, rule.Changes))
+		}
+		if persistence.RDB != nil && persistence.RDB.Compression != nil {
+			lines = append(lines, "rdbcompression "+yesOrNo(*persistence.RDB.Compression))
+		}
+	}
+	if mode == redisv1alpha1.PersistenceModeAOF || mode == redisv1alpha1.PersistenceModeHybrid {
+		lines = append(lines, "appendonly yes", "aof-use-rdb-preamble "+yesOrNo(mode == redisv1alpha1.PersistenceModeHybrid))
+		if aof := persistence.AOF; aof != nil {
+			if aof.AppendFsync != "" {
+				lines = append(lines, "appendfsync "+aof.AppendFsync)
+			}
+			if aof.AutoRewritePercentage != nil {
+				lines = append(lines, fmt.Sprintf("auto-aof-rewrite-percentage %d", *aof.AutoRewritePercentage))
+			}
+			if aof.AutoRewriteMinSize != nil {
+				lines = append(lines, fmt.Sprintf("auto-aof-rewrite-min-size %d", aof.AutoRewriteMinSize.Value()))
+			}
+		}
+	} else {
+		lines = append(lines, "appendonly no")
+	}
+	return lines
+}
+
+func yesOrNo(value bool) string {
+	if value {
+		return "yes"
+	}
+	return "no"
+}
+
+// 生成operator管理的配置，用户的additionalRedisConfig追加在后面，可覆盖operator生成的配置
+// certUsers为true时按客户端证书CN认证ACL用户
+func generateRedisConfigData(cr *redisv1alpha1.Redis, certUsers bool) (map[string]string, error) {
+	data := map[string]string{}
+	key := redisAdditionalConfigKey
+	var lines []string
+	if getRedisFlavor(cr) == redisv1alpha1.RedisFlavorDragonfly {
+		key = dragonflyFlagsKey
+		lines = generateDragonflyFlags(cr)
+	} else {
+		lines = append(lines, generateAuthConfig(cr)...)
+		if cr.Spec.Persistence != nil {
+			lines = append(lines, generatePersistenceConfig(cr.Spec.Persistence)...)
+		}
+		lines = append(lines, generateMaxMemoryConfig(cr)...)
+		lines = append(lines, generateModuleConfig(cr)...)
+		lines = append(lines, generateFlavorConfig(cr)...)
+		lines = append(lines, generateTLSConfig(cr, certUsers)...)
+	}
+	if cr.Spec.RedisConfig != nil && cr.Spec.RedisConfig.AdditionalRedisConfig != nil {
+		userConfig, err := generateK8sClient().CoreV1().ConfigMaps(cr.Namespace).Get(context.TODO(), *cr.Spec.RedisConfig.AdditionalRedisConfig, metav1.GetOptions{})
+		if err != nil {
+			configMapLogger(cr.Namespace, *cr.Spec.RedisConfig.AdditionalRedisConfig).Error(err, "Failed in getting additional redis config")
+			return nil, err
+		}
+		for k, v := range userConfig.Data {
+			data[k] = v
+		}
+		if userLines, ok := userConfig.Data[key]; ok {
+			lines = append(lines, userLines)
+		}
+	}
+	data[key] = strings.Join(lines, "\n") + "\n"
+	return data, nil
+}
+
+// 计算配置摘要
+func getRedisConfigHash(data map[string]string) string {
+	keys := make([]string, 0, len(data))
+	for k := range data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	hash := sha256.New()
+	for _, k := range keys {
+		fmt.Fprintf(hash, "%s\x00%s\x00", k, data[k])
+	}
+	return fmt.Sprintf("%x", hash.Sum(nil))[:16]
+}
+
+// 创建或更新operator管理的redis配置，返回配置摘要
+func CreateOrUpdateRedisConfig(cr *redisv1alpha1.Redis, cl client.Client, labels map[string]string) (hash string, err error) {
+	name := getRedisConfigMapName(cr)
+	logger := configMapLogger(cr.Namespace, name)
+	result := "unchanged"
+	defer func() {
+		if err != nil {
+			result = "error"
+		}
+		recordConfigApply(cr.Namespace, cr.Name, result)
+	}()
+	if err := validateRedisPersistence(cr); err != nil {
+		logger.Error(err, "Invalid redis persistence configuration")
+		recordEvent(cr, corev1.EventTypeWarning, EventReasonValidationFailed, "%v", err)
+		return "", err
+	}
+	certUsers, err := hasClientCertificateACLUsers(cr, cl)
+	if err != nil {
+		return "", err
+	}
+	data, err := generateRedisConfigData(cr, certUsers)
+	if err != nil {
+		return "", err
+	}
+	configMap := &corev1.ConfigMap{
+		TypeMeta:   generateMetaInformation("ConfigMap", "v1"),
+		ObjectMeta: generateObjectMetaInformation(name, cr.Namespace, labels, generateObjectAnots(cr.ObjectMeta)),
+		Data:       data,
+	}
+	AddOwnerRefToObject(configMap, redisAsOwner(cr))
+	stored, err := generateK8sClient().CoreV1().ConfigMaps(cr.Namespace).Get(context.TODO(), name, metav1.GetOptions{})
+	if err != nil {
+		if !errors.IsNotFound(err) {
+			return "", err
+		}
+		if err := patch.DefaultAnnotator.SetLastAppliedAnnotation(configMap); err != nil {
+			logger.Error(err, "Unable to patch redis configMap with comparison object")
+			return "", err
+		}
+		if _, err := generateK8sClient().CoreV1().ConfigMaps(cr.Namespace).Create(context.TODO(), configMap, metav1.CreateOptions{}); err != nil {
+			logger.Error(err, "Redis configMap creation failed")
+			recordOwnerEvent(configMap, "ConfigMap", corev1.EventTypeWarning, EventReasonCreateFailed, "%v", err)
+			return "", err
+		}
+		recordOwnerEvent(configMap, "ConfigMap", corev1.EventTypeNormal, EventReasonCreated, "created")
+		logger.Info("Redis configMap creation was successful")
+		result = "created"
+		return getRedisConfigHash(data), nil
+	}
+	configMap.ResourceVersion = stored.ResourceVersion
+	patchResult, err := patch.DefaultPatchMaker.Calculate(stored, configMap,
+		patch.IgnoreField("kind"),
+		patch.IgnoreField("apiVersion"),
+	)
+	if err != nil {
+		logger.Error(err, "Unable to patch redis configMap with comparison object")
+		return "", err
+	}
+	if !patchResult.IsEmpty() {
+		logger.Info("Changes in redis configMap Detected, Updating...", "patch", string(patchResult.Patch))
+		recordManagedUpdate("ConfigMap", stored, configMap)
+		if err := patch.DefaultAnnotator.SetLastAppliedAnnotation(configMap); err != nil {
+			logger.Error(err, "Unable to patch redis configMap with comparison object")
+			return "", err
+		}
+		if _, err := generateK8sClient().CoreV1().ConfigMaps(cr.Namespace).Update(context.TODO(), configMap, metav1.UpdateOptions{}); err != nil {
+			logger.Error(err, "Redis configMap update failed")
+			recordOwnerEvent(configMap, "ConfigMap", corev1.EventTypeWarning, EventReasonUpdateFailed, "%v", err)
+			return "", err
+		}
+		recordOwnerEvent(configMap, "ConfigMap", corev1.EventTypeNormal, EventReasonUpdated, "changed %s", summarizePatch(patchResult.Patch))
+		result = "updated"
+	}
+	return getRedisConfigHash(data), nil
+}
@@ -0,0 +1,71 @@
+package k8sutils
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	redisv1alpha1 "github.com/superwongo/redis-operator/api/v1alpha1"
+)
+
+func TestGeneratePersistenceConfig(t *testing.T) {
+	compression := false
+	percentage := int32(50)
+	minSize := resource.MustParse("64Mi")
+	tests := []struct {
+		name        string
+		persistence *redisv1alpha1.Persistence
+		want        []string
+	}{
+		{
+			name:        "none",
+			persistence: &redisv1alpha1.Persistence{Mode: redisv1alpha1.PersistenceModeNone},
+			want:        []string{`save ""`, "appendonly no"},
+		},
+		{
+			name:        "rdb with default rules",
+			persistence: &redisv1alpha1.Persistence{Mode: redisv1alpha1.PersistenceModeRDB},
+			want:        []string{`save ""`, "save 3600 1", "save 300 100", "save 60 10000", "appendonly no"},
+		},
+		{
+			name: "rdb with custom rules",
+			persistence: &redisv1alpha1.Persistence{
+				Mode: redisv1alpha1.PersistenceModeRDB,
+				RDB: &redisv1alpha1.RDBPersistence{
+					SaveRules:   []redisv1alpha1.RDBSaveRule{{Seconds: 900, Changes: 1}},
+					Compression: &compression,
+				},
+			},
+			want: []string{`save ""`, "save 900 1", "rdbcompression no", "appendonly no"},
+		},
+		{
+			name:        "aof without options",
+			persistence: &redisv1alpha1.Persistence{Mode: redisv1alpha1.PersistenceModeAOF},
+			want:        []string{`save ""`, "appendonly yes", "aof-use-rdb-preamble no"},
+		},
+		{
+			name: "aof with options",
+			persistence: &redisv1alpha1.Persistence{
+				Mode: redisv1alpha1.PersistenceModeAOF,
+				AOF: &redisv1alpha1.AOFPersistence{
+					AppendFsync:           "always",
+					AutoRewritePercentage: &percentage,
+					AutoRewriteMinSize:    &minSize,
+				},
+			},
+			want: []string{`save ""`, "appendonly yes", "aof-use-rdb-preamble no", "appendfsync always",
+				"auto-aof-rewrite-percentage 50", "auto-aof-rewrite-min-size 67108864"},
+		},
+		{
+			name:        "hybrid",
+			persistence: &redisv1alpha1.Persistence{Mode: redisv1alpha1.PersistenceModeHybrid},
+			want:        []string{`save ""`, "save 3600 1", "save 300 100", "save 60 10000", "appendonly yes", "aof-use-rdb-preamble yes"},
+		},
+	}
+	for _, tt := range tests {
+		if got := generatePersistenceConfig(tt.persistence); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: generatePersistenceConfig() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
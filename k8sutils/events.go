@@ -0,0 +1,88 @@
+package k8sutils
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+)
+
+// 事件原因
+const (
+	EventReasonCreated             = "Created"
+	EventReasonCreateFailed        = "CreateFailed"
+	EventReasonUpdated             = "Updated"
+	EventReasonUpdateFailed        = "UpdateFailed"
+	EventReasonUpdateIgnored       = "UpdateIgnored"
+	EventReasonValidationFailed    = "ValidationFailed"
+	EventReasonFinalizeFailed      = "FinalizeFailed"
+	EventReasonFailover            = "Failover"
+	EventReasonFailoverFailed      = "FailoverFailed"
+	EventReasonPaused              = "Paused"
+	EventReasonResumed             = "Resumed"
+	EventReasonUpgrading           = "Upgrading"
+	EventReasonUpgraded            = "Upgraded"
+	EventReasonUpgradeHalted       = "UpgradeHalted"
+	EventReasonUpgradeUnverified   = "UpgradeUnverified"
+	EventReasonCertificateNotReady = "CertificateNotReady"
+	EventReasonPDBSkipped          = "PodDisruptionBudgetSkipped"
+)
+
+var eventRecorder record.EventRecorder
+
+// 设置manager创建的EventRecorder，未设置时不发送事件
+func SetEventRecorder(recorder record.EventRecorder) {
+	eventRecorder = recorder
+}
+
+// 向对象发送事件
+func recordEvent(obj runtime.Object, eventType string, reason string, messageFmt string, args ...interface{}) {
+	if eventRecorder == nil {
+		return
+	}
+	eventRecorder.Eventf(obj, eventType, reason, messageFmt, args...)
+}
+
+// 向受管对象的所属redis发送事件，消息中带上受管对象的类型及名称
+func recordOwnerEvent(obj metav1.Object, kind string, eventType string, reason string, messageFmt string, args ...interface{}) {
+	for _, ownerRef := range obj.GetOwnerReferences() {
+		if ownerRef.Controller == nil || !*ownerRef.Controller {
+			continue
+		}
+		owner := &corev1.ObjectReference{
+			APIVersion: ownerRef.APIVersion,
+			Kind:       ownerRef.Kind,
+			Name:       ownerRef.Name,
+			UID:        ownerRef.UID,
+			Namespace:  obj.GetNamespace(),
+		}
+		recordEvent(owner, eventType, reason, "%s %s: %s", kind, obj.GetName(), fmt.Sprintf(messageFmt, args...))
+		return
+	}
+}
+
+// 汇总merge patch中变化的字段路径，最多展开两层
+func summarizePatch(patch []byte) string {
+	var changes map[string]interface{}
+	if err := json.Unmarshal(patch, &changes); err != nil {
+		return ""
+	}
+	var paths []string
+	for key, value := range changes {
+		nested, ok := value.(map[string]interface{})
+		if !ok || len(nested) == 0 {
+			paths = append(paths, key)
+			continue
+		}
+		for nestedKey := range nested {
+			paths = append(paths, key+"."+nestedKey)
+		}
+	}
+	sort.Strings(paths)
+	return strings.Join(paths, ", ")
+}
@@ -0,0 +1,23 @@
+package k8sutils
+
+import "testing"
+
+func TestSummarizePatch(t *testing.T) {
+	tests := []struct {
+		name  string
+		patch string
+		want  string
+	}{
+		{name: "invalid json", patch: "not json", want: ""},
+		{name: "empty patch", patch: "{}", want: ""},
+		{name: "top level field", patch: `{"data":null}`, want: "data"},
+		{name: "nested fields are sorted", patch: `{"spec":{"template":{"spec":{}},"replicas":2}}`, want: "spec.replicas, spec.template"},
+		{name: "empty nested object", patch: `{"metadata":{}}`, want: "metadata"},
+		{name: "multiple top level fields", patch: `{"spec":{"ports":[]},"metadata":{"labels":{"app":"redis"}}}`, want: "metadata.labels, spec.ports"},
+	}
+	for _, tt := range tests {
+		if got := summarizePatch([]byte(tt.patch)); got != tt.want {
+			t.Errorf("%s: summarizePatch() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
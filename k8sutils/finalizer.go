@@ -5,6 +5,7 @@ import (
 
 	"github.com/go-logr/logr"
 	redisv1alpha1 "github.com/superwongo/redis-operator/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
@@ -32,10 +33,12 @@ func HandlerRedisFinalizer(cr *redisv1alpha1.Redis, cl client.Client) error {
 		if controllerutil.ContainsFinalizer(cr, RedisFinalizer) {
 			// 删除其service、headless service资源
 			if err := finalizeRedisService(cr); err != nil {
+				recordEvent(cr, corev1.EventTypeWarning, EventReasonFinalizeFailed, "unable to delete services: %v", err)
 				return err
 			}
 			// 删除其pvc资源
 			if err := finalizeRedisPVC(cr); err != nil {
+				recordEvent(cr, corev1.EventTypeWarning, EventReasonFinalizeFailed, "unable to delete persistent volume claims: %v", err)
 				return err
 			}
 		}
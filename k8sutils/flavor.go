@@ -0,0 +1,273 @@
+package k8sutils
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"path"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	redisv1alpha1 "github.com/superwongo/redis-operator/api/v1alpha1"
+)
+
+const (
+	// dragonfly不兼容redis.conf语法，使用flagfile
+	dragonflyFlagsKey = "dragonfly.flags"
+	externalConfigDir = "/etc/redis/external.conf.d"
+	// 密码配置保存在secret中挂载，不出现在启动参数里
+	authConfigDir      = "/etc/redis/auth.conf.d"
+	authConfigKey      = "auth.conf"
+	dragonflyAuthFlags = "auth.flags"
+)
+
+// 引擎默认配置
+type flavorDefaults struct {
+	Image string
+	// 服务端启动命令，为空时使用镜像的entrypoint
+	Server string
+	// 命令行客户端
+	CLI string
+}
+
+// keydb仅发布按架构区分的版本标签，非x86_64节点需设置KubernetesConfig.image
+var flavors = map[redisv1alpha1.RedisFlavor]flavorDefaults{
+	redisv1alpha1.RedisFlavorRedis:     {CLI: "redis-cli"},
+	redisv1alpha1.RedisFlavorValkey:    {Image: "valkey/valkey:7.2.7", Server: "valkey-server", CLI: "valkey-cli"},
+	redisv1alpha1.RedisFlavorKeyDB:     {Image: "eqalpha/keydb:x86_64_v6.3.4", Server: "keydb-server", CLI: "keydb-cli"},
+	redisv1alpha1.RedisFlavorDragonfly: {Image: "docker.dragonflydb.io/dragonflydb/dragonfly:v1.25.1"},
+}
+
+// 获取引擎类型，默认redis
+func getRedisFlavor(cr *redisv1alpha1.Redis) redisv1alpha1.RedisFlavor {
+	if cr.Spec.Flavor == "" {
+		return redisv1alpha1.RedisFlavorRedis
+	}
+	return cr.Spec.Flavor
+}
+
+// 获取redis镜像，未设置时使用引擎默认镜像
+func getRedisImage(cr *redisv1alpha1.Redis) string {
+	if cr.Spec.KubernetesConfig.Image != "" {
+		return cr.Spec.KubernetesConfig.Image
+	}
+	return flavors[getRedisFlavor(cr)].Image
+}
+
+// 校验所选引擎是否支持spec中的配置
+func validateRedisFlavor(cr *redisv1alpha1.Redis) error {
+	flavor := getRedisFlavor(cr)
+	if _, ok := flavors[flavor]; !ok {
+		return fmt.Errorf("unknown flavor %q", flavor)
+	}
+	if getRedisImage(cr) == "" {
+		return fmt.Errorf("KubernetesConfig.image is required for flavor %s", flavor)
+	}
+	if cr.Spec.Engine != nil && cr.Spec.Engine.ActiveReplication && flavor != redisv1alpha1.RedisFlavorKeyDB {
+		return fmt.Errorf("spec.engine.activeReplication is only supported by flavor keydb")
+	}
+	if flavor == redisv1alpha1.RedisFlavorDragonfly {
+		if len(cr.Spec.Modules) > 0 {
+			return fmt.Errorf("spec.modules is not supported by flavor dragonfly")
+		}
+		// dragonfly快照为.dfs格式，没有dump.rdb
+		if cr.Spec.RestoreFrom != nil {
+			return fmt.Errorf("spec.restoreFrom is not supported by flavor dragonfly")
+		}
+		if persistence := cr.Spec.Persistence; persistence != nil {
+			if persistence.Mode == redisv1alpha1.PersistenceModeAOF || persistence.Mode == redisv1alpha1.PersistenceModeHybrid {
+				return fmt.Errorf("persistence mode %s is not supported by flavor dragonfly", persistence.Mode)
+			}
+			if persistence.RDB != nil && len(persistence.RDB.SaveRules) > 0 {
+				return fmt.Errorf("spec.persistence.rdb.saveRules is not supported by flavor dragonfly")
+			}
+		}
+	}
+	return nil
+}
+
+// 引擎相关的redis.conf配置
+func generateFlavorConfig(cr *redisv1alpha1.Redis) []string {
+	engine := cr.Spec.Engine
+	if engine == nil {
+		return nil
+	}
+	var lines []string
+	if engine.Threads != nil {
+		if getRedisFlavor(cr) == redisv1alpha1.RedisFlavorKeyDB {
+			lines = append(lines, fmt.Sprintf("server-threads %d", *engine.Threads))
+		} else {
+			lines = append(lines, fmt.Sprintf("io-threads %d", *engine.Threads))
+		}
+	}
+	if engine.ActiveReplication {
+		lines = append(lines, "active-replica yes")
+	}
+	return lines
+}
+
+// 生成dragonfly启动参数文件
+func generateDragonflyFlags(cr *redisv1alpha1.Redis) []string {
+	var flags []string
+	if cr.Spec.RedisStorage != nil {
+		flags = append(flags, "--dir="+redisDataPath)
+	}
+	if persistence := cr.Spec.Persistence; persistence != nil && persistence.Mode == redisv1alpha1.PersistenceModeNone {
+		flags = append(flags, "--dbfilename=")
+	} else if cr.Spec.RedisStorage != nil {
+		flags = append(flags, "--dbfilename="+strings.TrimSuffix(redisRDBFile, ".rdb"))
+	}
+	for _, line := range generateMaxMemoryConfig(cr) {
+		fields := strings.Fields(line)
+		switch fields[0] {
+		case "maxmemory":
+			flags = append(flags, "--maxmemory="+fields[1])
+		case "maxmemory-policy":
+			// dragonfly仅支持开启或关闭缓存淘汰
+			flags = append(flags, fmt.Sprintf("--cache_mode=%t", fields[1] != "noeviction"))
+		}
+	}
+	if cr.Spec.Engine != nil && cr.Spec.Engine.Threads != nil {
+		flags = append(flags, fmt.Sprintf("--proactor_threads=%d", *cr.Spec.Engine.Threads))
+	}
+	return flags
+}
+
+// redis镜像的entrypoint自行处理密码，其他引擎的密码由operator写入配置
+func usesAuthConfig(cr *redisv1alpha1.Redis) bool {
+	secret := cr.Spec.KubernetesConfig.ExistingPasswordSecret
+	return secret != nil && secret.Name != nil && secret.Key != nil && getRedisFlavor(cr) != redisv1alpha1.RedisFlavorRedis
+}
+
+// operator管理的密码配置secret名称
+func getRedisAuthConfigSecretName(cr *redisv1alpha1.Redis) string {
+	return cr.Name + "-operator-auth"
+}
+
+// 按redis.conf的双引号语法转义
+func quoteConfigValue(value string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`)
+	return `"` + replacer.Replace(value) + `"`
+}
+
+// 生成密码配置，dragonfly为flagfile格式
+func generateAuthConfigData(flavor redisv1alpha1.RedisFlavor, password string) map[string][]byte {
+	if flavor == redisv1alpha1.RedisFlavorDragonfly {
+		return map[string][]byte{dragonflyAuthFlags: []byte("--requirepass=" + password + "\n")}
+	}
+	quoted := quoteConfigValue(password)
+	return map[string][]byte{authConfigKey: []byte("requirepass " + quoted + "\nmasterauth " + quoted + "\n")}
+}
+
+// 从密码secret生成密码配置secret，返回配置摘要，无需密码配置时返回空
+func CreateOrUpdateRedisAuthConfig(cr *redisv1alpha1.Redis, labels map[string]string) (string, error) {
+	if !usesAuthConfig(cr) {
+		return "", nil
+	}
+	name := getRedisAuthConfigSecretName(cr)
+	logger := redisLogger(cr.Namespace, name)
+	passwordSecret := cr.Spec.KubernetesConfig.ExistingPasswordSecret
+	password, err := getRedisPassword(cr.Namespace, *passwordSecret.Name, *passwordSecret.Key)
+	if err != nil {
+		return "", err
+	}
+	secret := &corev1.Secret{
+		TypeMeta:   generateMetaInformation("Secret", "v1"),
+		ObjectMeta: generateObjectMetaInformation(name, cr.Namespace, labels, generateObjectAnots(cr.ObjectMeta)),
+		Type:       corev1.SecretTypeOpaque,
+		Data:       generateAuthConfigData(getRedisFlavor(cr), password),
+	}
+	AddOwnerRefToObject(secret, redisAsOwner(cr))
+	data := map[string]string{}
+	for k, v := range secret.Data {
+		data[k] = string(v)
+	}
+	secrets := generateK8sClient().CoreV1().Secrets(cr.Namespace)
+	stored, err := secrets.Get(context.TODO(), name, metav1.GetOptions{})
+	if err != nil {
+		if !errors.IsNotFound(err) {
+			return "", err
+		}
+		if _, err := secrets.Create(context.TODO(), secret, metav1.CreateOptions{}); err != nil {
+			logger.Error(err, "Redis auth config secret creation failed")
+			return "", err
+		}
+		logger.Info("Redis auth config secret created")
+		return getRedisConfigHash(data), nil
+	}
+	if !authConfigChanged(stored.Data, secret.Data) {
+		return getRedisConfigHash(data), nil
+	}
+	secret.ResourceVersion = stored.ResourceVersion
+	if _, err := secrets.Update(context.TODO(), secret, metav1.UpdateOptions{}); err != nil {
+		logger.Error(err, "Redis auth config secret update failed")
+		return "", err
+	}
+	logger.Info("Redis auth config secret updated")
+	return getRedisConfigHash(data), nil
+}
+
+func authConfigChanged(stored map[string][]byte, desired map[string][]byte) bool {
+	if len(stored) != len(desired) {
+		return true
+	}
+	for k, v := range desired {
+		if !bytes.Equal(stored[k], v) {
+			return true
+		}
+	}
+	return false
+}
+
+// 引用密码配置的redis.conf配置
+func generateAuthConfig(cr *redisv1alpha1.Redis) []string {
+	if !usesAuthConfig(cr) {
+		return nil
+	}
+	return []string{"include " + path.Join(authConfigDir, authConfigKey)}
+}
+
+// 挂载密码配置secret
+func getAuthConfigVolume(secretName string) corev1.Volume {
+	return corev1.Volume{
+		Name: "auth-config",
+		VolumeSource: corev1.VolumeSource{
+			Secret: &corev1.SecretVolumeSource{SecretName: secretName},
+		},
+	}
+}
+
+func getAuthConfigVolumeMount() corev1.VolumeMount {
+	return corev1.VolumeMount{
+		Name:      "auth-config",
+		ReadOnly:  true,
+		MountPath: authConfigDir,
+	}
+}
+
+// 生成引擎启动参数，redis使用镜像entrypoint加载配置，TLS配置由operator配置文件下发
+// 密码通过authConfigSecret挂载的配置加载，不出现在启动参数中
+func getFlavorArgs(flavor redisv1alpha1.RedisFlavor, authConfigSecret *string, persistenceEnabled *bool, tlsConfig *redisv1alpha1.TLSConfig) []string {
+	switch flavor {
+	case redisv1alpha1.RedisFlavorValkey, redisv1alpha1.RedisFlavorKeyDB:
+		args := []string{flavors[flavor].Server, path.Join(externalConfigDir, redisAdditionalConfigKey)}
+		if persistenceEnabled != nil && *persistenceEnabled {
+			args = append(args, "--dir", redisDataPath)
+		}
+		return args
+	case redisv1alpha1.RedisFlavorDragonfly:
+		flagFiles := []string{path.Join(externalConfigDir, dragonflyFlagsKey)}
+		if authConfigSecret != nil {
+			flagFiles = append(flagFiles, path.Join(authConfigDir, dragonflyAuthFlags))
+		}
+		args := []string{"--flagfile=" + strings.Join(flagFiles, ",")}
+		if tlsConfig != nil {
+			args = append(args, "--tls", "--tls_cert_file=$(REDIS_TLS_CERT)", "--tls_key_file=$(REDIS_TLS_CERT_KEY)", "--tls_ca_cert_file=$(REDIS_TLS_CA_KEY)")
+		}
+		return args
+	}
+	return nil
+}
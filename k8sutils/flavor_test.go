@@ -0,0 +1,27 @@
+package k8sutils
+
+import (
+	"testing"
+
+	redisv1alpha1 "github.com/superwongo/redis-operator/api/v1alpha1"
+)
+
+func TestGenerateAuthConfigData(t *testing.T) {
+	tests := []struct {
+		name     string
+		flavor   redisv1alpha1.RedisFlavor
+		password string
+		key      string
+		want     string
+	}{
+		{name: "valkey", flavor: redisv1alpha1.RedisFlavorValkey, password: "s3cret", key: authConfigKey, want: "requirepass \"s3cret\"\nmasterauth \"s3cret\"\n"},
+		{name: "quotes and backslashes", flavor: redisv1alpha1.RedisFlavorKeyDB, password: `a"b\c`, key: authConfigKey, want: "requirepass \"a\\\"b\\\\c\"\nmasterauth \"a\\\"b\\\\c\"\n"},
+		{name: "dragonfly", flavor: redisv1alpha1.RedisFlavorDragonfly, password: "s3cret", key: dragonflyAuthFlags, want: "--requirepass=s3cret\n"},
+	}
+	for _, tt := range tests {
+		data := generateAuthConfigData(tt.flavor, tt.password)
+		if got := string(data[tt.key]); got != tt.want {
+			t.Errorf("%s: generateAuthConfigData()[%s] = %q, want %q", tt.name, tt.key, got, tt.want)
+		}
+	}
+}
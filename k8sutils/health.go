@@ -0,0 +1,110 @@
+package k8sutils
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	redisv1alpha1 "github.com/superwongo/redis-operator/api/v1alpha1"
+)
+
+const (
+	// 单次健康检查超时时间
+	healthCheckTimeout = 5 * time.Second
+	// 健康状态未变化时的最短刷新间隔，避免频繁更新status触发协调
+	healthRefreshInterval = 30 * time.Second
+)
+
+// 通过PING及INFO检查redis运行状态，更新status.health及Healthy状态
+func UpdateRedisHealthStatus(cr *redisv1alpha1.Redis, cl client.Client) error {
+	now := metav1.Now()
+	health, condition := checkRedisHealth(cr)
+	health.LastCheckTime = &now
+	condition.Type = redisv1alpha1.ConditionHealthy
+	condition.ObservedGeneration = cr.Generation
+
+	existing := meta.FindStatusCondition(cr.Status.Conditions, condition.Type)
+	conditionChanged := existing == nil || existing.Status != condition.Status ||
+		existing.Reason != condition.Reason || existing.Message != condition.Message
+	if !conditionChanged && cr.Status.Health != nil && cr.Status.Health.LastCheckTime != nil &&
+		now.Sub(cr.Status.Health.LastCheckTime.Time) < healthRefreshInterval {
+		return nil
+	}
+	if conditionChanged && condition.Status == metav1.ConditionFalse {
+		redisLogger(cr.Namespace, cr.Name).Info("Redis is not healthy", "reason", condition.Reason, "message", condition.Message)
+	}
+	cr.Status.Health = health
+	meta.SetStatusCondition(&cr.Status.Conditions, condition)
+	return cl.Status().Update(context.TODO(), cr)
+}
+
+// 执行健康检查，返回运行状态及Healthy状态（未设置Type）
+func checkRedisHealth(cr *redisv1alpha1.Redis) (*redisv1alpha1.RedisHealth, metav1.Condition) {
+	health := &redisv1alpha1.RedisHealth{}
+	rc, err := configureRedisClient(cr, getRedisPodName(cr))
+	if err != nil {
+		return health, metav1.Condition{Status: metav1.ConditionFalse, Reason: "Unreachable", Message: "redis pod is not running"}
+	}
+	defer rc.Close()
+	ctx, cancel := context.WithTimeout(context.TODO(), healthCheckTimeout)
+	defer cancel()
+	if err := rc.Ping(ctx).Err(); err != nil {
+		// 加载数据期间PING返回LOADING错误
+		if isRedisLoadingError(err) {
+			health.Loading = true
+			return health, metav1.Condition{Status: metav1.ConditionFalse, Reason: "Loading", Message: "redis is loading the dataset in memory"}
+		}
+		return health, metav1.Condition{Status: metav1.ConditionFalse, Reason: "Unreachable", Message: fmt.Sprintf("PING failed: %v", err)}
+	}
+	info, err := rc.Info(ctx).Result()
+	if err != nil {
+		return health, metav1.Condition{Status: metav1.ConditionFalse, Reason: "Unreachable", Message: fmt.Sprintf("INFO failed: %v", err)}
+	}
+	health.Role = parseRedisInfo(info, "role")
+	health.Version = parseRedisInfo(info, "redis_version")
+	health.Loading = parseRedisInfo(info, "loading") == "1"
+	health.UsedMemory = parseRedisInfoInt(info, "used_memory")
+	health.MaxMemory = parseRedisInfoInt(info, "maxmemory")
+	health.ConnectedClients = parseRedisInfoInt(info, "connected_clients")
+	health.ConnectedReplicas = parseRedisInfoInt(info, "connected_slaves")
+	health.MasterLinkStatus = parseRedisInfo(info, "master_link_status")
+	health.LastSaveStatus = parseRedisInfo(info, "rdb_last_bgsave_status")
+	if lastSave := parseRedisInfoInt(info, "rdb_last_save_time"); lastSave > 0 {
+		lastSaveTime := metav1.NewTime(time.Unix(lastSave, 0))
+		health.LastSaveTime = &lastSaveTime
+	}
+	if parseRedisInfo(info, "aof_enabled") == "1" {
+		health.AOFWriteStatus = parseRedisInfo(info, "aof_last_write_status")
+	}
+
+	switch {
+	case health.Loading:
+		return health, metav1.Condition{Status: metav1.ConditionFalse, Reason: "Loading", Message: "redis is loading the dataset in memory"}
+	case health.LastSaveStatus == "err":
+		return health, metav1.Condition{Status: metav1.ConditionFalse, Reason: "PersistenceFailed", Message: "last background save failed"}
+	case health.AOFWriteStatus == "err":
+		return health, metav1.Condition{Status: metav1.ConditionFalse, Reason: "PersistenceFailed", Message: "last AOF write failed"}
+	case health.Role == "slave" && health.MasterLinkStatus != "up":
+		return health, metav1.Condition{Status: metav1.ConditionFalse, Reason: "ReplicationBroken", Message: fmt.Sprintf("master link is %s", health.MasterLinkStatus)}
+	}
+	return health, metav1.Condition{Status: metav1.ConditionTrue, Reason: "Available", Message: fmt.Sprintf("redis %s is serving requests", health.Role)}
+}
+
+func isRedisLoadingError(err error) bool {
+	return strings.HasPrefix(err.Error(), "LOADING")
+}
+
+// 解析INFO中的整数字段，缺失或非法时返回0
+func parseRedisInfoInt(info string, key string) int64 {
+	value, err := strconv.ParseInt(parseRedisInfo(info, key), 10, 64)
+	if err != nil {
+		return 0
+	}
+	return value
+}
@@ -32,6 +32,11 @@ func generateObjectAnots(stsMeta metav1.ObjectMeta) map[string]string {
 // 删除一些自动添加的无用注解
 func filterAnnotations(anots map[string]string) map[string]string {
 	delete(anots, "kubectl.kubernetes.io/last-applied-configuration")
+	// operator控制注解不下发到受管对象，避免切换时触发pod重启
+	delete(anots, RedisPausedAnnotation)
+	delete(anots, RedisMaintenanceAnnotation)
+	delete(anots, MigrationCutoverAnnotation)
+	delete(anots, RedisRestartAtAnnotation)
 	return anots
 }
 
@@ -63,6 +68,16 @@ func AddOwnerRefToObject(obj metav1.Object, ownerRef metav1.OwnerReference) {
 	obj.SetOwnerReferences(append(obj.GetOwnerReferences(), ownerRef))
 }
 
+// 对象是否由指定所有者创建
+func isOwnedBy(obj metav1.Object, ownerRef metav1.OwnerReference) bool {
+	for _, ref := range obj.GetOwnerReferences() {
+		if ref.UID == ownerRef.UID {
+			return true
+		}
+	}
+	return false
+}
+
 // 设置redis所属对象
 func redisAsOwner(cr *redisv1alpha1.Redis) metav1.OwnerReference {
 	trueVar := true
@@ -0,0 +1,142 @@
+package k8sutils
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	redisv1alpha1 "github.com/superwongo/redis-operator/api/v1alpha1"
+)
+
+const defaultMaxMemoryPercent = 75
+
+// 获取redis容器内存limit
+func getRedisMemoryLimit(cr *redisv1alpha1.Redis) (int64, bool) {
+	resources := cr.Spec.KubernetesConfig.Resources
+	if resources == nil {
+		return 0, false
+	}
+	limit, ok := resources.Limits[corev1.ResourceMemory]
+	if !ok || limit.IsZero() {
+		return 0, false
+	}
+	return limit.Value(), true
+}
+
+// 生成maxmemory相关配置
+func generateMaxMemoryConfig(cr *redisv1alpha1.Redis) []string {
+	var lines []string
+	memory := cr.Spec.Memory
+	if memory != nil && memory.MaxMemory != nil {
+		lines = append(lines, fmt.Sprintf("maxmemory %d", memory.MaxMemory.Value()))
+	} else if limit, ok := getRedisMemoryLimit(cr); ok {
+		percent := int64(defaultMaxMemoryPercent)
+		if memory != nil && memory.MaxMemoryPercent != nil {
+			percent = int64(*memory.MaxMemoryPercent)
+		}
+		lines = append(lines, fmt.Sprintf("maxmemory %d", limit*percent/100))
+	}
+	if memory != nil && memory.MaxMemoryPolicy != "" {
+		lines = append(lines, "maxmemory-policy "+memory.MaxMemoryPolicy)
+	}
+	return lines
+}
+
+// 解析redis配置中的内存大小，支持k/kb/m/mb/g/gb单位
+func parseRedisMemory(value string) (int64, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	units := []struct {
+		suffix string
+		factor int64
+	}{
+		{"kb", 1 << 10}, {"mb", 1 << 20}, {"gb", 1 << 30},
+		{"k", 1000}, {"m", 1000 * 1000}, {"g", 1000 * 1000 * 1000},
+	}
+	for _, unit := range units {
+		if strings.HasSuffix(value, unit.suffix) {
+			n, err := strconv.ParseInt(strings.TrimSuffix(value, unit.suffix), 10, 64)
+			return n * unit.factor, err
+		}
+	}
+	return strconv.ParseInt(value, 10, 64)
+}
+
+// 获取配置中最终生效的maxmemory，兼容dragonfly的--maxmemory=参数格式
+func getEffectiveMaxMemory(config string) (int64, bool, error) {
+	var value string
+	found := false
+	for _, line := range strings.Split(config, "\n") {
+		line = strings.Replace(strings.TrimPrefix(strings.TrimSpace(line), "--"), "=", " ", 1)
+		fields := strings.Fields(line)
+		if len(fields) == 2 && strings.ToLower(fields[0]) == "maxmemory" {
+			value, found = fields[1], true
+		}
+	}
+	if !found {
+		return 0, false, nil
+	}
+	maxMemory, err := parseRedisMemory(value)
+	return maxMemory, true, err
+}
+
+// 检查生效的maxmemory是否超过容器内存limit，并更新MaxMemoryValid状态
+func UpdateRedisMaxMemoryCondition(cr *redisv1alpha1.Redis, cl client.Client) error {
+	limit, ok := getRedisMemoryLimit(cr)
+	if !ok {
+		if meta.FindStatusCondition(cr.Status.Conditions, redisv1alpha1.ConditionMaxMemoryValid) == nil {
+			return nil
+		}
+		meta.RemoveStatusCondition(&cr.Status.Conditions, redisv1alpha1.ConditionMaxMemoryValid)
+		return cl.Status().Update(context.TODO(), cr)
+	}
+	configMap, err := generateK8sClient().CoreV1().ConfigMaps(cr.Namespace).Get(context.TODO(), getRedisConfigMapName(cr), metav1.GetOptions{})
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	condition := metav1.Condition{
+		Type:               redisv1alpha1.ConditionMaxMemoryValid,
+		Status:             metav1.ConditionTrue,
+		Reason:             "WithinLimit",
+		ObservedGeneration: cr.Generation,
+	}
+	key := redisAdditionalConfigKey
+	if getRedisFlavor(cr) == redisv1alpha1.RedisFlavorDragonfly {
+		key = dragonflyFlagsKey
+	}
+	maxMemory, found, err := getEffectiveMaxMemory(configMap.Data[key])
+	switch {
+	case err != nil:
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = "InvalidMaxMemory"
+		condition.Message = err.Error()
+	case !found || maxMemory == 0:
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = "Unlimited"
+		condition.Message = fmt.Sprintf("maxmemory is unlimited while the memory limit is %d bytes, redis may be OOM-killed", limit)
+	case maxMemory > limit:
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = "ExceedsLimit"
+		condition.Message = fmt.Sprintf("maxmemory %d exceeds the memory limit %d, redis may be OOM-killed", maxMemory, limit)
+	default:
+		condition.Message = fmt.Sprintf("maxmemory %d of memory limit %d", maxMemory, limit)
+	}
+	if existing := meta.FindStatusCondition(cr.Status.Conditions, condition.Type); existing != nil &&
+		existing.Status == condition.Status && existing.Reason == condition.Reason && existing.Message == condition.Message {
+		return nil
+	}
+	if condition.Status == metav1.ConditionFalse {
+		redisLogger(cr.Namespace, cr.Name).Info("Redis maxmemory is not safe", "reason", condition.Reason, "message", condition.Message)
+	}
+	meta.SetStatusCondition(&cr.Status.Conditions, condition)
+	return cl.Status().Update(context.TODO(), cr)
+}
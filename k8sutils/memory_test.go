@@ -0,0 +1,61 @@
+package k8sutils
+
+import "testing"
+
+func TestParseRedisMemory(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    int64
+		wantErr bool
+	}{
+		{value: "1024", want: 1024},
+		{value: "1kb", want: 1 << 10},
+		{value: "100mb", want: 100 << 20},
+		{value: "2GB", want: 2 << 30},
+		{value: "1k", want: 1000},
+		{value: "5m", want: 5 * 1000 * 1000},
+		{value: " 1g ", want: 1000 * 1000 * 1000},
+		{value: "0", want: 0},
+		{value: "abc", wantErr: true},
+		{value: "1.5gb", wantErr: true},
+		{value: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseRedisMemory(tt.value)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseRedisMemory(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && got != tt.want {
+			t.Errorf("parseRedisMemory(%q) = %d, want %d", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestGetEffectiveMaxMemory(t *testing.T) {
+	tests := []struct {
+		name      string
+		config    string
+		want      int64
+		wantFound bool
+		wantErr   bool
+	}{
+		{name: "not set", config: "appendonly yes\nsave 900 1"},
+		{name: "redis syntax", config: "maxmemory 100mb", want: 100 << 20, wantFound: true},
+		{name: "last value wins", config: "maxmemory 1gb\nmaxmemory-policy allkeys-lru\nmaxmemory 2gb", want: 2 << 30, wantFound: true},
+		{name: "case insensitive", config: "MAXMEMORY 1024", want: 1024, wantFound: true},
+		{name: "dragonfly flag", config: "--maxmemory=512mb\n--proactor_threads=2", want: 512 << 20, wantFound: true},
+		{name: "policy only", config: "maxmemory-policy noeviction"},
+		{name: "invalid value", config: "maxmemory lots", wantFound: true, wantErr: true},
+	}
+	for _, tt := range tests {
+		got, found, err := getEffectiveMaxMemory(tt.config)
+		if (err != nil) != tt.wantErr || found != tt.wantFound {
+			t.Errorf("%s: getEffectiveMaxMemory() found = %v, error = %v, want found %v, wantErr %v", tt.name, found, err, tt.wantFound, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && got != tt.want {
+			t.Errorf("%s: getEffectiveMaxMemory() = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
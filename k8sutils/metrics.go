@@ -0,0 +1,221 @@
+package k8sutils
+
+import (
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/banzaicloud/k8s-objectmatcher/patch"
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	redisv1alpha1 "github.com/superwongo/redis-operator/api/v1alpha1"
+)
+
+const metricsNamespace = "redis_operator"
+
+// managed_object_updates_total中的更新原因
+const (
+	managedUpdateDrift      = "drift"
+	managedUpdateSpecChange = "spec_change"
+)
+
+// managed_instances中的实例阶段
+const (
+	RedisPhasePending = "Pending"
+	RedisPhaseReady   = "Ready"
+	RedisPhaseFailed  = "Failed"
+)
+
+var (
+	reconcileDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "reconcile_duration_seconds",
+		Help:      "Duration of each reconcile phase in seconds.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"phase"})
+	reconcileTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "reconcile_total",
+		Help:      "Number of reconcile phases by outcome.",
+	}, []string{"phase", "result"})
+	managedInstances = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "managed_instances",
+		Help:      "Number of managed redis instances by topology and phase.",
+	}, []string{"setup_type", "phase"})
+	failoversTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "failovers_total",
+		Help:      "Number of failovers triggered by the operator by outcome.",
+	}, []string{"namespace", "name", "result"})
+	backupsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "backups_total",
+		Help:      "Number of finished backups by outcome.",
+	}, []string{"namespace", "redis", "result"})
+	backupLastSuccess = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "backup_last_success_timestamp_seconds",
+		Help:      "Unix timestamp of the last successful backup, backup age is time() minus this value.",
+	}, []string{"namespace", "redis"})
+	configApplyTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "config_apply_total",
+		Help:      "Number of redis config applies by outcome.",
+	}, []string{"namespace", "name", "result"})
+	managedUpdatesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "managed_object_updates_total",
+		Help:      "Number of managed object updates by reason, drift when the live object was changed outside the operator, spec_change when the desired state changed.",
+	}, []string{"kind", "reason"})
+)
+
+func init() {
+	metrics.Registry.MustRegister(
+		reconcileDuration,
+		reconcileTotal,
+		managedInstances,
+		failoversTotal,
+		backupsTotal,
+		backupLastSuccess,
+		configApplyTotal,
+		managedUpdatesTotal,
+	)
+}
+
+// 实例的拓扑及阶段，用于汇总managed_instances
+type instanceState struct {
+	SetupType string
+	Phase     string
+}
+
+var (
+	instanceStatesLock sync.Mutex
+	instanceStates     = map[string]instanceState{}
+)
+
+func resultLabel(err error) string {
+	if err != nil {
+		return "error"
+	}
+	return "success"
+}
+
+// 记录协调阶段耗时及结果
+func ObserveReconcilePhase(phase string, start time.Time, err error) {
+	reconcileDuration.WithLabelValues(phase).Observe(time.Since(start).Seconds())
+	reconcileTotal.WithLabelValues(phase, resultLabel(err)).Inc()
+}
+
+// 记录实例当前阶段并重新汇总实例数
+func RecordRedisInstance(namespace string, name string, setupType string, phase string) {
+	instanceStatesLock.Lock()
+	defer instanceStatesLock.Unlock()
+	instanceStates[namespace+"/"+name] = instanceState{SetupType: setupType, Phase: phase}
+	updateManagedInstances()
+}
+
+// 按statefulset就绪副本数判断单例阶段
+func GetStandaloneRedisPhase(cr *redisv1alpha1.Redis) string {
+	sts, err := GetStatefulSet(cr.Namespace, cr.Name)
+	if err != nil || sts.Spec.Replicas == nil || sts.Status.ReadyReplicas < *sts.Spec.Replicas {
+		return RedisPhasePending
+	}
+	return RedisPhaseReady
+}
+
+// 实例删除后不再计数
+func ForgetRedisInstance(namespace string, name string) {
+	instanceStatesLock.Lock()
+	defer instanceStatesLock.Unlock()
+	delete(instanceStates, namespace+"/"+name)
+	updateManagedInstances()
+}
+
+func updateManagedInstances() {
+	managedInstances.Reset()
+	for _, state := range instanceStates {
+		managedInstances.WithLabelValues(state.SetupType, state.Phase).Inc()
+	}
+}
+
+// 记录operator触发的故障切换结果
+func RecordFailover(namespace string, name string, err error) {
+	failoversTotal.WithLabelValues(namespace, name, resultLabel(err)).Inc()
+}
+
+// 记录备份结果，成功时更新最近成功时间
+func RecordBackupResult(namespace string, redisName string, succeeded bool) {
+	if !succeeded {
+		backupsTotal.WithLabelValues(namespace, redisName, "failed").Inc()
+		return
+	}
+	backupsTotal.WithLabelValues(namespace, redisName, "succeeded").Inc()
+	backupLastSuccess.WithLabelValues(namespace, redisName).SetToCurrentTime()
+}
+
+// 记录配置下发结果：created、updated、unchanged或error
+func recordConfigApply(namespace string, name string, result string) {
+	configApplyTotal.WithLabelValues(namespace, name, result).Inc()
+}
+
+// 记录受管对象的更新，需在补全注解、设置last-applied注解之前调用
+func recordManagedUpdate(kind string, stored runtime.Object, desired runtime.Object) {
+	reason := managedUpdateSpecChange
+	if isLiveDrift(stored, desired) {
+		reason = managedUpdateDrift
+	}
+	managedUpdatesTotal.WithLabelValues(kind, reason).Inc()
+}
+
+// 上次下发的期望状态与本次生成的一致时，差异只可能来自对线上对象的修改
+func isLiveDrift(stored runtime.Object, desired runtime.Object) bool {
+	lastApplied, err := patch.DefaultAnnotator.GetOriginalConfiguration(stored)
+	if err != nil || lastApplied == nil {
+		return false
+	}
+	modified, err := patch.DefaultAnnotator.GetModifiedConfiguration(desired.DeepCopyObject(), false)
+	if err != nil {
+		return false
+	}
+	_, applied, err := patch.DeleteNullInJson(lastApplied)
+	if err != nil {
+		return false
+	}
+	_, generated, err := patch.DeleteNullInJson(modified)
+	if err != nil {
+		return false
+	}
+	normalizeLastApplied(applied, generated)
+	normalizeLastApplied(generated, generated)
+	return reflect.DeepEqual(applied, generated)
+}
+
+// resourceVersion每次更新都会变化；last-applied中还包含从线上对象补全的注解，只比较本次生成的注解
+func normalizeLastApplied(obj map[string]interface{}, generated map[string]interface{}) {
+	metadata, ok := obj["metadata"].(map[string]interface{})
+	if !ok {
+		return
+	}
+	delete(metadata, "resourceVersion")
+	annotations, ok := metadata["annotations"].(map[string]interface{})
+	if !ok {
+		return
+	}
+	wanted := map[string]interface{}{}
+	if generatedMetadata, ok := generated["metadata"].(map[string]interface{}); ok {
+		if generatedAnnotations, ok := generatedMetadata["annotations"].(map[string]interface{}); ok {
+			wanted = generatedAnnotations
+		}
+	}
+	for k := range annotations {
+		if _, present := wanted[k]; !present {
+			delete(annotations, k)
+		}
+	}
+	if len(annotations) == 0 {
+		delete(metadata, "annotations")
+	}
+}
@@ -0,0 +1,66 @@
+package k8sutils
+
+import (
+	"testing"
+
+	"github.com/banzaicloud/k8s-objectmatcher/patch"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestIsLiveDrift(t *testing.T) {
+	newService := func(port int32) *corev1.Service {
+		return &corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: "cache", Namespace: "apps", Annotations: map[string]string{"redis.opstreelabs.in": "true"}},
+			Spec:       corev1.ServiceSpec{Ports: []corev1.ServicePort{{Name: "redis", Port: port}}},
+		}
+	}
+	applied := newService(6379)
+	applied.ResourceVersion = "1"
+	applied.Annotations["external.example.com/owner"] = "team"
+	if err := patch.DefaultAnnotator.SetLastAppliedAnnotation(applied); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		stored  func() *corev1.Service
+		desired *corev1.Service
+		want    bool
+	}{
+		{
+			name: "live object edited",
+			stored: func() *corev1.Service {
+				s := applied.DeepCopy()
+				s.ResourceVersion = "2"
+				s.Spec.Ports[0].Port = 7000
+				return s
+			},
+			desired: newService(6379),
+			want:    true,
+		},
+		{
+			name:    "desired state changed",
+			stored:  applied.DeepCopy,
+			desired: newService(7000),
+			want:    false,
+		},
+		{
+			name: "no last-applied annotation",
+			stored: func() *corev1.Service {
+				s := applied.DeepCopy()
+				delete(s.Annotations, patch.LastAppliedConfig)
+				return s
+			},
+			desired: newService(6379),
+			want:    false,
+		},
+	}
+	for _, tt := range tests {
+		stored := tt.stored()
+		tt.desired.ResourceVersion = stored.ResourceVersion
+		if got := isLiveDrift(stored, tt.desired); got != tt.want {
+			t.Errorf("%s: isLiveDrift() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,283 @@
+package k8sutils
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"strconv"
+
+	"github.com/go-redis/redis/v8"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	redisv1alpha1 "github.com/superwongo/redis-operator/api/v1alpha1"
+)
+
+const (
+	// 设置为true时将迁移中的实例提升为主节点
+	MigrationCutoverAnnotation = "redis.superwongo.com/migration-cutover"
+)
+
+// 获取迁移源端密码
+func getMigrationPassword(cr *redisv1alpha1.Redis) (string, error) {
+	secret := cr.Spec.Migration.PasswordSecret
+	if secret == nil || secret.Name == nil || secret.Key == nil {
+		return "", nil
+	}
+	return getRedisPassword(cr.Namespace, *secret.Name, *secret.Key)
+}
+
+// 初始化迁移源端客户端，用于获取源端复制偏移量
+func configureMigrationSourceClient(cr *redisv1alpha1.Redis, password string) (*redis.Client, error) {
+	source := cr.Spec.Migration
+	opts := &redis.Options{
+		Addr:     net.JoinHostPort(source.Host, strconv.Itoa(int(source.Port))),
+		Username: source.Username,
+		Password: password,
+		DB:       0,
+	}
+	if source.TLS {
+		tlsConfig, err := getMigrationTLSConfig(cr)
+		if err != nil {
+			return nil, err
+		}
+		opts.TLSConfig = tlsConfig
+	}
+	return redis.NewClient(opts), nil
+}
+
+// 按tlsConfig初始化连接源端的TLS配置，不复用实例自身的服务端证书
+func getMigrationTLSConfig(cr *redisv1alpha1.Redis) (*tls.Config, error) {
+	source := cr.Spec.Migration
+	tlsConfig := &tls.Config{ServerName: source.Host}
+	options := source.TLSConfig
+	if options == nil {
+		return tlsConfig, nil
+	}
+	if options.ServerName != "" {
+		tlsConfig.ServerName = options.ServerName
+	}
+	secrets := generateK8sClient().CoreV1().Secrets(cr.Namespace)
+	if options.CASecret != "" {
+		secret, err := secrets.Get(context.TODO(), options.CASecret, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		caPool := x509.NewCertPool()
+		if !caPool.AppendCertsFromPEM(secret.Data["ca.crt"]) {
+			return nil, fmt.Errorf("no valid CA certificate found in secret %s", secret.Name)
+		}
+		tlsConfig.RootCAs = caPool
+	}
+	if options.ClientCertSecret != "" {
+		secret, err := secrets.Get(context.TODO(), options.ClientCertSecret, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		cert, err := tls.X509KeyPair(secret.Data[corev1.TLSCertKey], secret.Data[corev1.TLSPrivateKeyKey])
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
+
+// 将实例配置为源端的从节点，认证信息通过CONFIG SET下发
+func startRedisMigration(ctx context.Context, rc *redis.Client, cr *redisv1alpha1.Redis, password string) error {
+	source := cr.Spec.Migration
+	if password != "" {
+		if err := rc.ConfigSet(ctx, "masterauth", password).Err(); err != nil {
+			return err
+		}
+	}
+	if source.Username != "" {
+		if err := rc.ConfigSet(ctx, "masteruser", source.Username).Err(); err != nil {
+			return err
+		}
+	}
+	// 本地开启TLS时配置文件默认tls-replication yes，需按源端是否使用TLS覆盖
+	if source.TLS || getRedisTLSSpec(cr) != nil {
+		if err := rc.ConfigSet(ctx, "tls-replication", yesOrNo(source.TLS)).Err(); err != nil {
+			return err
+		}
+	}
+	return rc.Do(ctx, "REPLICAOF", source.Host, strconv.Itoa(int(source.Port))).Err()
+}
+
+// 校验迁移配置
+func validateRedisMigration(cr *redisv1alpha1.Redis) error {
+	source := cr.Spec.Migration
+	if source.Host == "" {
+		return fmt.Errorf("spec.migration.host is required")
+	}
+	if source.TLS && getRedisTLSSpec(cr) == nil {
+		return fmt.Errorf("spec.migration.tls requires spec.TLS or spec.autoTLS to be set")
+	}
+	return nil
+}
+
+// 协调外部redis迁移：保持REPLICAOF源端，记录复制延迟，收到切换注解后执行REPLICAOF NO ONE
+func ReconcileRedisMigration(cr *redisv1alpha1.Redis, cl client.Client) error {
+	if cr.Spec.Migration == nil {
+		return nil
+	}
+	logger := redisLogger(cr.Namespace, cr.Name)
+	status := &redisv1alpha1.MigrationStatus{}
+	if cr.Status.Migration != nil {
+		// 切换完成后不再重新同步
+		if cr.Status.Migration.Phase == redisv1alpha1.MigrationPhaseCutOver {
+			return nil
+		}
+		status = cr.Status.Migration.DeepCopy()
+	}
+	if err := validateRedisMigration(cr); err != nil {
+		status.Phase = redisv1alpha1.MigrationPhaseFailed
+		status.Message = err.Error()
+		return updateRedisMigrationStatus(cr, cl, status)
+	}
+	rc, err := configureRedisClient(cr, getRedisPodName(cr))
+	if err != nil {
+		logger.Info("Redis is not ready for migration yet", "reason", err.Error())
+		return nil
+	}
+	defer rc.Close()
+	ctx := context.TODO()
+	password, err := getMigrationPassword(cr)
+	if err != nil {
+		return err
+	}
+
+	// 同步完成且延迟在允许范围内才切换，避免提升数据不完整的实例，拒绝时继续同步
+	cutoverMessage := ""
+	if cr.Annotations[MigrationCutoverAnnotation] == "true" {
+		err := checkMigrationCutoverReady(ctx, rc, cr, password)
+		if err == nil {
+			return cutoverRedisMigration(ctx, rc, cr, cl, status)
+		}
+		cutoverMessage = "cutover refused: " + err.Error()
+		if status.Message != cutoverMessage {
+			logger.Info("Redis migration cutover refused", "reason", err.Error())
+			recordEvent(cr, corev1.EventTypeWarning, EventReasonFailoverFailed, "%s", cutoverMessage)
+		}
+	}
+
+	info, err := rc.Info(ctx, "replication").Result()
+	if err != nil {
+		return err
+	}
+	// 实例重启后复制关系丢失，需要重新下发
+	if parseRedisInfo(info, "role") != "slave" || parseRedisInfo(info, "master_host") != cr.Spec.Migration.Host ||
+		parseRedisInfo(info, "master_port") != strconv.Itoa(int(cr.Spec.Migration.Port)) {
+		logger.Info("Configuring redis as replica of migration source", "host", cr.Spec.Migration.Host, "port", cr.Spec.Migration.Port)
+		if err := startRedisMigration(ctx, rc, cr, password); err != nil {
+			status.Phase = redisv1alpha1.MigrationPhaseFailed
+			status.Message = err.Error()
+			return updateRedisMigrationStatus(cr, cl, status)
+		}
+		status.Phase = redisv1alpha1.MigrationPhaseSyncing
+		status.Message = ""
+		return updateRedisMigrationStatus(cr, cl, status)
+	}
+
+	status.MasterLinkStatus = parseRedisInfo(info, "master_link_status")
+	status.ReplicaOffset, _ = strconv.ParseInt(parseRedisInfo(info, "slave_repl_offset"), 10, 64)
+	status.Message = ""
+	if sourceOffset, err := getMigrationSourceOffset(ctx, cr, password); err != nil {
+		status.Message = "unable to query source offset: " + err.Error()
+	} else {
+		status.SourceOffset = sourceOffset
+		status.Lag = sourceOffset - status.ReplicaOffset
+		if status.Lag < 0 {
+			status.Lag = 0
+		}
+	}
+	status.Phase = redisv1alpha1.MigrationPhaseSyncing
+	if status.MasterLinkStatus == "up" && parseRedisInfo(info, "master_sync_in_progress") == "0" {
+		status.Phase = redisv1alpha1.MigrationPhaseSynced
+	}
+	if cutoverMessage != "" {
+		status.Message = cutoverMessage
+	}
+	return updateRedisMigrationStatus(cr, cl, status)
+}
+
+// 执行REPLICAOF NO ONE将实例提升为主节点
+func cutoverRedisMigration(ctx context.Context, rc *redis.Client, cr *redisv1alpha1.Redis, cl client.Client, status *redisv1alpha1.MigrationStatus) error {
+	logger := redisLogger(cr.Namespace, cr.Name)
+	err := rc.Do(ctx, "REPLICAOF", "NO", "ONE").Err()
+	RecordFailover(cr.Namespace, cr.Name, err)
+	if err != nil {
+		logger.Error(err, "Unable to promote redis during migration cutover")
+		recordEvent(cr, corev1.EventTypeWarning, EventReasonFailoverFailed, "migration cutover failed: %v", err)
+		return err
+	}
+	logger.Info("Redis migration cut over, instance promoted to primary")
+	recordEvent(cr, corev1.EventTypeNormal, EventReasonFailover, "promoted to primary, no longer replicating %s:%d", cr.Spec.Migration.Host, cr.Spec.Migration.Port)
+	now := metav1.Now()
+	status.Phase = redisv1alpha1.MigrationPhaseCutOver
+	status.CutoverTime = &now
+	status.Message = ""
+	meta.SetStatusCondition(&cr.Status.Conditions, metav1.Condition{
+		Type:               redisv1alpha1.ConditionMigrated,
+		Status:             metav1.ConditionTrue,
+		Reason:             "CutOver",
+		Message:            fmt.Sprintf("promoted from replica of %s:%d", cr.Spec.Migration.Host, cr.Spec.Migration.Port),
+		ObservedGeneration: cr.Generation,
+	})
+	return updateRedisMigrationStatus(cr, cl, status)
+}
+
+// 检查是否可以切换：复制链路正常、全量同步已完成且与源端的偏移量差值不超过maxCutoverLag
+func checkMigrationCutoverReady(ctx context.Context, rc *redis.Client, cr *redisv1alpha1.Redis, password string) error {
+	if cr.Status.Migration == nil || cr.Status.Migration.Phase != redisv1alpha1.MigrationPhaseSynced {
+		return fmt.Errorf("migration is not synced yet")
+	}
+	info, err := rc.Info(ctx, "replication").Result()
+	if err != nil {
+		return err
+	}
+	if parseRedisInfo(info, "master_link_status") != "up" || parseRedisInfo(info, "master_sync_in_progress") != "0" {
+		return fmt.Errorf("replication link to the source is not up")
+	}
+	replicaOffset, err := strconv.ParseInt(parseRedisInfo(info, "slave_repl_offset"), 10, 64)
+	if err != nil {
+		return fmt.Errorf("unable to read replica offset: %v", err)
+	}
+	sourceOffset, err := getMigrationSourceOffset(ctx, cr, password)
+	if err != nil {
+		return fmt.Errorf("unable to query source offset: %v", err)
+	}
+	if lag := sourceOffset - replicaOffset; lag > cr.Spec.Migration.MaxCutoverLag {
+		return fmt.Errorf("replication lag %d exceeds maxCutoverLag %d", lag, cr.Spec.Migration.MaxCutoverLag)
+	}
+	return nil
+}
+
+// 查询源端复制偏移量
+func getMigrationSourceOffset(ctx context.Context, cr *redisv1alpha1.Redis, password string) (int64, error) {
+	sc, err := configureMigrationSourceClient(cr, password)
+	if err != nil {
+		return 0, err
+	}
+	defer sc.Close()
+	info, err := sc.Info(ctx, "replication").Result()
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(parseRedisInfo(info, "master_repl_offset"), 10, 64)
+}
+
+// 迁移状态变化时更新redis status
+func updateRedisMigrationStatus(cr *redisv1alpha1.Redis, cl client.Client, status *redisv1alpha1.MigrationStatus) error {
+	if equality.Semantic.DeepEqual(cr.Status.Migration, status) && status.Phase != redisv1alpha1.MigrationPhaseCutOver {
+		return nil
+	}
+	cr.Status.Migration = status
+	return cl.Status().Update(context.TODO(), cr)
+}
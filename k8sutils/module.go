@@ -0,0 +1,147 @@
+package k8sutils
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	redisv1alpha1 "github.com/superwongo/redis-operator/api/v1alpha1"
+)
+
+const (
+	modulesVolumeName = "redis-modules"
+	modulesMountPath  = "/modules"
+	// 拉取OCI制品中模块文件的镜像
+	defaultModulePullerImage = "ghcr.io/oras-project/oras:v1.2.0"
+)
+
+// 从外部获取模块所需的init容器及共享卷
+type moduleParameters struct {
+	InitContainers []corev1.Container
+	Volumes        []corev1.Volume
+	VolumeMounts   []corev1.VolumeMount
+}
+
+// 模块文件在redis容器中的路径，OCI制品拉取到以模块名命名的目录中
+func getModulePath(module redisv1alpha1.RedisModule) string {
+	if module.Path != "" {
+		return module.Path
+	}
+	if module.Image != "" {
+		return path.Join(modulesMountPath, module.Name, module.ImagePath)
+	}
+	return path.Join(modulesMountPath, module.Name+".so")
+}
+
+// 校验模块配置
+func validateRedisModules(cr *redisv1alpha1.Redis) error {
+	for _, module := range cr.Spec.Modules {
+		sources := 0
+		for _, source := range []string{module.Path, module.URL, module.Image} {
+			if source != "" {
+				sources++
+			}
+		}
+		if sources != 1 {
+			return fmt.Errorf("exactly one of path, url and image must be set for module %s", module.Name)
+		}
+		if module.Image != "" && module.ImagePath == "" {
+			return fmt.Errorf("imagePath is required when image is set for module %s", module.Name)
+		}
+	}
+	return nil
+}
+
+// 生成下载模块的init容器，模块文件复制到共享的emptyDir卷
+func generateModuleParams(cr *redisv1alpha1.Redis) (*moduleParameters, error) {
+	if err := validateRedisModules(cr); err != nil {
+		return nil, err
+	}
+	params := &moduleParameters{}
+	mount := corev1.VolumeMount{Name: modulesVolumeName, MountPath: modulesMountPath}
+	for _, module := range cr.Spec.Modules {
+		target := getModulePath(module)
+		container := corev1.Container{
+			Name:            "module-" + module.Name,
+			ImagePullPolicy: module.ImagePullPolicy,
+			VolumeMounts:    []corev1.VolumeMount{mount},
+		}
+		switch {
+		case module.URL != "":
+			container.Image = defaultURLImage
+			container.Command = []string{"curl", "-fsSL", "-o", target, module.URL}
+		case module.Image != "":
+			// 通过oras拉取制品，不运行制品本身，支持不含shell的scratch镜像
+			container.Image = defaultModulePullerImage
+			container.Args = []string{"pull", module.Image, "-o", path.Join(modulesMountPath, module.Name)}
+		default:
+			continue
+		}
+		params.InitContainers = append(params.InitContainers, container)
+	}
+	if len(params.InitContainers) > 0 {
+		params.Volumes = append(params.Volumes, corev1.Volume{
+			Name:         modulesVolumeName,
+			VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}},
+		})
+		mount.ReadOnly = true
+		params.VolumeMounts = append(params.VolumeMounts, mount)
+	}
+	return params, nil
+}
+
+// 生成loadmodule配置
+func generateModuleConfig(cr *redisv1alpha1.Redis) []string {
+	var lines []string
+	for _, module := range cr.Spec.Modules {
+		lines = append(lines, strings.TrimSpace("loadmodule "+getModulePath(module)+" "+strings.Join(module.Args, " ")))
+	}
+	return lines
+}
+
+// 通过MODULE LIST更新已加载模块
+func UpdateRedisModuleStatus(cr *redisv1alpha1.Redis, cl client.Client) error {
+	if len(cr.Spec.Modules) == 0 && len(cr.Status.Modules) == 0 {
+		return nil
+	}
+	rc, err := configureRedisClient(cr, getRedisPodName(cr))
+	if err != nil {
+		return nil
+	}
+	defer rc.Close()
+	result, err := rc.Do(context.TODO(), "MODULE", "LIST").Slice()
+	if err != nil {
+		redisLogger(cr.Namespace, cr.Name).Error(err, "Unable to list redis modules")
+		return nil
+	}
+	modules := []redisv1alpha1.ModuleStatus{}
+	for _, item := range result {
+		fields, ok := item.([]interface{})
+		if !ok {
+			continue
+		}
+		module := redisv1alpha1.ModuleStatus{}
+		for i := 0; i+1 < len(fields); i += 2 {
+			switch fmt.Sprint(fields[i]) {
+			case "name":
+				module.Name = fmt.Sprint(fields[i+1])
+			case "ver":
+				module.Version = fmt.Sprint(fields[i+1])
+			}
+		}
+		modules = append(modules, module)
+	}
+	if len(modules) == 0 {
+		modules = nil
+	}
+	if equality.Semantic.DeepEqual(cr.Status.Modules, modules) {
+		return nil
+	}
+	cr.Status.Modules = modules
+	return cl.Status().Update(context.TODO(), cr)
+}
@@ -0,0 +1,219 @@
+package k8sutils
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-logr/logr"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	redisv1alpha1 "github.com/superwongo/redis-operator/api/v1alpha1"
+)
+
+const (
+	serviceMonitorKind = "ServiceMonitor"
+	podMonitorKind     = "PodMonitor"
+)
+
+var monitorGVRs = map[string]schema.GroupVersionResource{
+	serviceMonitorKind: {Group: "monitoring.coreos.com", Version: "v1", Resource: "servicemonitors"},
+	podMonitorKind:     {Group: "monitoring.coreos.com", Version: "v1", Resource: "podmonitors"},
+}
+
+func monitorLogger(namespace string, name string) logr.Logger {
+	reqLogger := log.Log.WithValues("Request.Monitor.Namespace", namespace, "Request.Monitor.Name", name)
+	return reqLogger
+}
+
+// 获取启用的监控对象配置
+func getRedisMonitor(cr *redisv1alpha1.Redis) *redisv1alpha1.RedisMonitor {
+	exporter := cr.Spec.RedisExporter
+	if exporter == nil || !exporter.Enabled || exporter.Monitor == nil || !exporter.Monitor.Enabled {
+		return nil
+	}
+	return exporter.Monitor
+}
+
+// 创建或更新exporter的ServiceMonitor/PodMonitor，未启用或切换类型时删除旧对象
+func ReconcileRedisMonitor(cr *redisv1alpha1.Redis) error {
+	monitor := getRedisMonitor(cr)
+	kind := ""
+	if monitor != nil {
+		kind = monitor.Kind
+		if kind == "" {
+			kind = serviceMonitorKind
+		}
+	}
+	for monitorKind, gvr := range monitorGVRs {
+		if monitorKind != kind {
+			if err := deleteUnstructured(gvr, cr.Namespace, cr.Name); err != nil {
+				return err
+			}
+		}
+	}
+	if monitor == nil {
+		return nil
+	}
+	if monitor.TLS != nil && getRedisTLSSpec(cr) == nil {
+		return fmt.Errorf("spec.exporter.monitor.tls requires spec.TLS or spec.autoTLS to be set")
+	}
+	_, err := createOrUpdateUnstructured(monitorGVRs[kind], generateMonitorDef(cr, monitor, kind), monitorLogger(cr.Namespace, cr.Name))
+	return err
+}
+
+// 初始化ServiceMonitor/PodMonitor声明
+func generateMonitorDef(cr *redisv1alpha1.Redis, monitor *redisv1alpha1.RedisMonitor, kind string) *unstructured.Unstructured {
+	podLabels := getRedisLabels(cr.ObjectMeta.Name, "standalone", "standalone", cr.ObjectMeta.Labels)
+	labels := map[string]interface{}{}
+	for k, v := range podLabels {
+		labels[k] = v
+	}
+	for k, v := range monitor.Labels {
+		labels[k] = v
+	}
+	matchLabels := map[string]interface{}{}
+	for k, v := range podLabels {
+		matchLabels[k] = v
+	}
+	endpoint := map[string]interface{}{"port": "redis-exporter", "path": "/metrics"}
+	if monitor.Interval != "" {
+		endpoint["interval"] = monitor.Interval
+	}
+	if monitor.ScrapeTimeout != "" {
+		endpoint["scrapeTimeout"] = monitor.ScrapeTimeout
+	}
+	if len(monitor.Relabelings) > 0 {
+		endpoint["relabelings"] = generateRelabelConfigs(monitor.Relabelings)
+	}
+	if len(monitor.MetricRelabelings) > 0 {
+		endpoint["metricRelabelings"] = generateRelabelConfigs(monitor.MetricRelabelings)
+	}
+	if monitor.TLS != nil {
+		tlsSpec := getRedisTLSSpec(cr)
+		caKey := caCertKey
+		if tlsSpec.CaKeyFile != "" {
+			caKey = tlsSpec.CaKeyFile
+		}
+		serverName := monitor.TLS.ServerName
+		if serverName == "" {
+			serverName = cr.Name + "." + cr.Namespace + ".svc"
+		}
+		endpoint["scheme"] = "https"
+		endpoint["tlsConfig"] = map[string]interface{}{
+			"ca": map[string]interface{}{"secret": map[string]interface{}{
+				"name": tlsSpec.Secret.SecretName,
+				"key":  caKey,
+			}},
+			"serverName":         serverName,
+			"insecureSkipVerify": monitor.TLS.InsecureSkipVerify,
+		}
+	}
+	spec := map[string]interface{}{
+		"selector": map[string]interface{}{"matchLabels": matchLabels},
+	}
+	if kind == podMonitorKind {
+		spec["podMetricsEndpoints"] = []interface{}{endpoint}
+	} else {
+		spec["endpoints"] = []interface{}{endpoint}
+	}
+	gvr := monitorGVRs[kind]
+	monitorDef := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": gvr.GroupVersion().String(),
+		"kind":       kind,
+		"metadata": map[string]interface{}{
+			"name":      cr.Name,
+			"namespace": cr.Namespace,
+			"labels":    labels,
+		},
+		"spec": spec,
+	}}
+	AddOwnerRefToObject(monitorDef, redisAsOwner(cr))
+	return monitorDef
+}
+
+// 转换标签重写规则
+func generateRelabelConfigs(configs []redisv1alpha1.RelabelConfig) []interface{} {
+	var relabelings []interface{}
+	for _, config := range configs {
+		relabeling := map[string]interface{}{}
+		if len(config.SourceLabels) > 0 {
+			sourceLabels := []interface{}{}
+			for _, label := range config.SourceLabels {
+				sourceLabels = append(sourceLabels, label)
+			}
+			relabeling["sourceLabels"] = sourceLabels
+		}
+		for key, value := range map[string]string{
+			"separator":   config.Separator,
+			"targetLabel": config.TargetLabel,
+			"regex":       config.Regex,
+			"replacement": config.Replacement,
+			"action":      config.Action,
+		} {
+			if value != "" {
+				relabeling[key] = value
+			}
+		}
+		if config.Modulus != 0 {
+			relabeling["modulus"] = int64(config.Modulus)
+		}
+		relabelings = append(relabelings, relabeling)
+	}
+	return relabelings
+}
+
+// 创建或更新unstructured对象，CRD不存在时跳过并返回nil
+func createOrUpdateUnstructured(gvr schema.GroupVersionResource, obj *unstructured.Unstructured, logger logr.Logger) (*unstructured.Unstructured, error) {
+	resources := generateK8sDynamicClient().Resource(gvr).Namespace(obj.GetNamespace())
+	stored, err := resources.Get(context.TODO(), obj.GetName(), metav1.GetOptions{})
+	switch {
+	case meta.IsNoMatchError(err) || (apierrors.IsNotFound(err) && isCRDMissing(err)):
+		logger.Info("CRD is not installed, skipping", "resource", gvr.String())
+		return nil, nil
+	case apierrors.IsNotFound(err):
+		if stored, err = resources.Create(context.TODO(), obj, metav1.CreateOptions{}); err != nil {
+			logger.Error(err, "Redis "+obj.GetKind()+" creation failed")
+			return nil, err
+		}
+		logger.Info("Redis " + obj.GetKind() + " creation was successful")
+		return stored, nil
+	case err != nil:
+		return nil, err
+	}
+	storedSpec, _, _ := unstructured.NestedMap(stored.Object, "spec")
+	newSpec, _, _ := unstructured.NestedMap(obj.Object, "spec")
+	if equalUnstructured(storedSpec, newSpec) && equalUnstructured(toInterfaceMap(stored.GetLabels()), toInterfaceMap(obj.GetLabels())) {
+		return stored, nil
+	}
+	stored.Object["spec"] = newSpec
+	stored.SetLabels(obj.GetLabels())
+	if stored, err = resources.Update(context.TODO(), stored, metav1.UpdateOptions{}); err != nil {
+		logger.Error(err, "Redis "+obj.GetKind()+" update failed")
+		return nil, err
+	}
+	logger.Info("Redis " + obj.GetKind() + " update successfully")
+	return stored, nil
+}
+
+func toInterfaceMap(m map[string]string) map[string]interface{} {
+	result := map[string]interface{}{}
+	for k, v := range m {
+		result[k] = v
+	}
+	return result
+}
+
+// 删除unstructured对象，对象或CRD不存在时忽略
+func deleteUnstructured(gvr schema.GroupVersionResource, namespace string, name string) error {
+	err := generateK8sDynamicClient().Resource(gvr).Namespace(namespace).Delete(context.TODO(), name, metav1.DeleteOptions{})
+	if err != nil && !apierrors.IsNotFound(err) && !meta.IsNoMatchError(err) {
+		monitorLogger(namespace, name).Error(err, "Could not delete redis "+gvr.Resource)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,200 @@
+package k8sutils
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	"github.com/banzaicloud/k8s-objectmatcher/patch"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	redisv1alpha1 "github.com/superwongo/redis-operator/api/v1alpha1"
+)
+
+const (
+	defaultMonitoringNamespace = "monitoring"
+	// kubernetes自动为namespace添加的名称标签
+	namespaceNameLabel = "kubernetes.io/metadata.name"
+)
+
+func networkPolicyLogger(namespace string, name string) logr.Logger {
+	reqLogger := log.Log.WithValues("Request.NetworkPolicy.Namespace", namespace, "Request.NetworkPolicy.Name", name)
+	return reqLogger
+}
+
+// 创建或更新redis单例NetworkPolicy，未设置access时删除
+func ReconcileStandaloneNetworkPolicy(cr *redisv1alpha1.Redis) error {
+	if cr.Spec.Access == nil {
+		return deleteNetworkPolicy(cr.Namespace, cr.Name, redisAsOwner(cr))
+	}
+	labels := getRedisLabels(cr.ObjectMeta.Name, "standalone", "standalone", cr.ObjectMeta.Labels)
+	objectMetaInfo := generateObjectMetaInformation(cr.ObjectMeta.Name, cr.Namespace, labels, generateObjectAnots(cr.ObjectMeta))
+	return CreateOrUpdateNetworkPolicy(cr.Namespace, objectMetaInfo, cr.Spec.Access, getPlaintextPort(getRedisTLSSpec(cr)), redisAsOwner(cr))
+}
+
+func CreateOrUpdateNetworkPolicy(namespace string, npMeta metav1.ObjectMeta, access *redisv1alpha1.RedisAccess, plaintextPort int32, ownerRef metav1.OwnerReference) error {
+	logger := networkPolicyLogger(namespace, npMeta.GetName())
+	npDef, err := generateNetworkPolicyDef(npMeta, access, plaintextPort, ownerRef)
+	if err != nil {
+		logger.Error(err, "Invalid redis access configuration")
+		recordOwnerEvent(&npMeta, "NetworkPolicy", corev1.EventTypeWarning, EventReasonValidationFailed, "%v", err)
+		return err
+	}
+	storedNP, err := generateK8sClient().NetworkingV1().NetworkPolicies(namespace).Get(context.TODO(), npMeta.GetName(), metav1.GetOptions{})
+	if err != nil {
+		if errors.IsNotFound(err) {
+			if err := patch.DefaultAnnotator.SetLastAppliedAnnotation(npDef); err != nil {
+				logger.Error(err, "Unable to patch redis NetworkPolicy with comparison object")
+				return err
+			}
+			_, err = generateK8sClient().NetworkingV1().NetworkPolicies(namespace).Create(context.TODO(), npDef, metav1.CreateOptions{})
+			if err != nil {
+				logger.Error(err, "Redis NetworkPolicy creation failed")
+				recordOwnerEvent(npDef, "NetworkPolicy", corev1.EventTypeWarning, EventReasonCreateFailed, "%v", err)
+				return err
+			}
+			recordOwnerEvent(npDef, "NetworkPolicy", corev1.EventTypeNormal, EventReasonCreated, "created")
+			logger.Info("Redis NetworkPolicy creation was successful")
+			return nil
+		}
+		return err
+	}
+	return patchNetworkPolicy(namespace, storedNP, npDef)
+}
+
+// 初始化NetworkPolicy声明：redis端口仅允许access.from、拓扑内pod及operator访问，exporter端口仅允许监控namespace访问
+func generateNetworkPolicyDef(npMeta metav1.ObjectMeta, access *redisv1alpha1.RedisAccess, plaintextPort int32, ownerRef metav1.OwnerReference) (*networkingv1.NetworkPolicy, error) {
+	clientPeers, err := generateNetworkPolicyPeers(access.From)
+	if err != nil {
+		return nil, err
+	}
+	// operator需要直连redis执行状态检查及运维命令
+	clientPeers = append(clientPeers, namespacePeer(getOperatorNamespace()))
+	redisPorts := []networkingv1.NetworkPolicyPort{networkPolicyPort(redisPort)}
+	if plaintextPort != 0 {
+		redisPorts = append(redisPorts, networkPolicyPort(plaintextPort))
+	}
+	monitoringNamespace := access.MonitoringNamespace
+	if monitoringNamespace == "" {
+		monitoringNamespace = defaultMonitoringNamespace
+	}
+	np := &networkingv1.NetworkPolicy{
+		TypeMeta:   generateMetaInformation("NetworkPolicy", "networking.k8s.io/v1"),
+		ObjectMeta: npMeta,
+		Spec: networkingv1.NetworkPolicySpec{
+			PodSelector: *labelSelector(npMeta.GetLabels()),
+			PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress},
+			Ingress: []networkingv1.NetworkPolicyIngressRule{
+				// 拓扑内复制及集群总线流量不限制端口
+				{From: []networkingv1.NetworkPolicyPeer{{PodSelector: labelSelector(npMeta.GetLabels())}}},
+				{From: clientPeers, Ports: redisPorts},
+				{From: []networkingv1.NetworkPolicyPeer{namespacePeer(monitoringNamespace)}, Ports: []networkingv1.NetworkPolicyPort{networkPolicyPort(redisExporterPort)}},
+			},
+		},
+	}
+	AddOwnerRefToObject(np, ownerRef)
+	return np, nil
+}
+
+// 转换access.from为NetworkPolicy来源
+func generateNetworkPolicyPeers(from []redisv1alpha1.AccessPeer) ([]networkingv1.NetworkPolicyPeer, error) {
+	var peers []networkingv1.NetworkPolicyPeer
+	for i, peer := range from {
+		if peer.CIDR != "" {
+			if peer.NamespaceSelector != nil || peer.PodSelector != nil {
+				return nil, fmt.Errorf("spec.access.from[%d]: cidr cannot be combined with selectors", i)
+			}
+			for _, cidr := range append([]string{peer.CIDR}, peer.Except...) {
+				if _, _, err := net.ParseCIDR(cidr); err != nil {
+					return nil, fmt.Errorf("spec.access.from[%d]: %v", i, err)
+				}
+			}
+			peers = append(peers, networkingv1.NetworkPolicyPeer{IPBlock: &networkingv1.IPBlock{CIDR: peer.CIDR, Except: peer.Except}})
+			continue
+		}
+		if peer.NamespaceSelector == nil && peer.PodSelector == nil {
+			return nil, fmt.Errorf("spec.access.from[%d]: one of namespaceSelector, podSelector and cidr is required", i)
+		}
+		peers = append(peers, networkingv1.NetworkPolicyPeer{NamespaceSelector: peer.NamespaceSelector, PodSelector: peer.PodSelector})
+	}
+	return peers, nil
+}
+
+// 按namespace名称选择来源
+func namespacePeer(namespace string) networkingv1.NetworkPolicyPeer {
+	return networkingv1.NetworkPolicyPeer{NamespaceSelector: labelSelector(map[string]string{namespaceNameLabel: namespace})}
+}
+
+func networkPolicyPort(port int32) networkingv1.NetworkPolicyPort {
+	protocol := corev1.ProtocolTCP
+	target := intstr.FromInt(int(port))
+	return networkingv1.NetworkPolicyPort{Protocol: &protocol, Port: &target}
+}
+
+func patchNetworkPolicy(namespace string, storedNP *networkingv1.NetworkPolicy, newNP *networkingv1.NetworkPolicy) error {
+	logger := networkPolicyLogger(namespace, newNP.GetName())
+	newNP.ResourceVersion = storedNP.ResourceVersion
+	newNP.CreationTimestamp = storedNP.CreationTimestamp
+	newNP.ManagedFields = storedNP.ManagedFields
+	patchResult, err := patch.DefaultPatchMaker.Calculate(storedNP, newNP,
+		patch.IgnoreStatusFields(),
+		patch.IgnoreField("kind"),
+		patch.IgnoreField("apiVersion"),
+	)
+	if err != nil {
+		logger.Error(err, "Unable to patch redis NetworkPolicy with comparison object")
+		return err
+	}
+	if patchResult.IsEmpty() {
+		logger.Info("Redis NetworkPolicy is already in-sync")
+		return nil
+	}
+	logger.Info("Changes in NetworkPolicy Detected, Updating...", "patch", string(patchResult.Patch))
+	recordManagedUpdate("NetworkPolicy", storedNP, newNP)
+	for k, v := range storedNP.Annotations {
+		if _, present := newNP.Annotations[k]; !present {
+			newNP.Annotations[k] = v
+		}
+	}
+	if err := patch.DefaultAnnotator.SetLastAppliedAnnotation(newNP); err != nil {
+		logger.Error(err, "Unable to patch redis NetworkPolicy with comparison object")
+		return err
+	}
+	_, err = generateK8sClient().NetworkingV1().NetworkPolicies(namespace).Update(context.TODO(), newNP, metav1.UpdateOptions{})
+	if err != nil {
+		logger.Error(err, "Redis NetworkPolicy update failed")
+		recordOwnerEvent(newNP, "NetworkPolicy", corev1.EventTypeWarning, EventReasonUpdateFailed, "%v", err)
+		return err
+	}
+	recordOwnerEvent(newNP, "NetworkPolicy", corev1.EventTypeNormal, EventReasonUpdated, "changed %s", summarizePatch(patchResult.Patch))
+	logger.Info("Redis NetworkPolicy update successfully")
+	return nil
+}
+
+// 删除不再需要的NetworkPolicy
+func deleteNetworkPolicy(namespace string, name string, ownerRef metav1.OwnerReference) error {
+	policies := generateK8sClient().NetworkingV1().NetworkPolicies(namespace)
+	storedPolicy, err := policies.Get(context.TODO(), name, metav1.GetOptions{})
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	// 不删除非operator创建的同名对象
+	if !isOwnedBy(storedPolicy, ownerRef) {
+		return nil
+	}
+	err = policies.Delete(context.TODO(), name, metav1.DeleteOptions{Preconditions: &metav1.Preconditions{UID: &storedPolicy.UID}})
+	if err != nil && !errors.IsNotFound(err) {
+		networkPolicyLogger(namespace, name).Error(err, "Could not delete redis NetworkPolicy")
+		return err
+	}
+	return nil
+}
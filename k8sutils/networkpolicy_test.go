@@ -0,0 +1,48 @@
+package k8sutils
+
+import (
+	"reflect"
+	"testing"
+
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	redisv1alpha1 "github.com/superwongo/redis-operator/api/v1alpha1"
+)
+
+func TestGenerateNetworkPolicyPeers(t *testing.T) {
+	appSelector := &metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}}
+	teamSelector := &metav1.LabelSelector{MatchLabels: map[string]string{"team": "payments"}}
+	tests := []struct {
+		name    string
+		from    []redisv1alpha1.AccessPeer
+		want    []networkingv1.NetworkPolicyPeer
+		wantErr bool
+	}{
+		{name: "empty", from: nil, want: nil},
+		{
+			name: "cidr with except",
+			from: []redisv1alpha1.AccessPeer{{CIDR: "10.0.0.0/8", Except: []string{"10.1.0.0/16"}}},
+			want: []networkingv1.NetworkPolicyPeer{{IPBlock: &networkingv1.IPBlock{CIDR: "10.0.0.0/8", Except: []string{"10.1.0.0/16"}}}},
+		},
+		{
+			name: "selectors",
+			from: []redisv1alpha1.AccessPeer{{PodSelector: appSelector}, {NamespaceSelector: teamSelector, PodSelector: appSelector}},
+			want: []networkingv1.NetworkPolicyPeer{{PodSelector: appSelector}, {NamespaceSelector: teamSelector, PodSelector: appSelector}},
+		},
+		{name: "invalid cidr", from: []redisv1alpha1.AccessPeer{{CIDR: "10.0.0.0"}}, wantErr: true},
+		{name: "invalid except", from: []redisv1alpha1.AccessPeer{{CIDR: "10.0.0.0/8", Except: []string{"nope"}}}, wantErr: true},
+		{name: "cidr with selector", from: []redisv1alpha1.AccessPeer{{CIDR: "10.0.0.0/8", PodSelector: appSelector}}, wantErr: true},
+		{name: "no source", from: []redisv1alpha1.AccessPeer{{PodSelector: appSelector}, {}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := generateNetworkPolicyPeers(tt.from)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: generateNetworkPolicyPeers() error = %v, wantErr %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: generateNetworkPolicyPeers() = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
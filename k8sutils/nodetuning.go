@@ -0,0 +1,210 @@
+package k8sutils
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	redisv1alpha1 "github.com/superwongo/redis-operator/api/v1alpha1"
+)
+
+const (
+	nodeTuningContainerName = "node-tuning"
+	// statefulset创建pod失败后按退避重试，超过该时间未再出现的FailedCreate事件视为已过期
+	createFailureWindow = 20 * time.Minute
+)
+
+// 节点调优所需的init容器及pod sysctls
+type nodeTuningParameters struct {
+	Container *corev1.Container
+	Sysctls   []corev1.Sysctl
+}
+
+// 根据nodeTuning生成调优参数，非特权模式下只通过unsafe sysctl设置somaxconn
+func generateNodeTuningParams(cr *redisv1alpha1.Redis) *nodeTuningParameters {
+	tuning := cr.Spec.NodeTuning
+	if tuning == nil || !tuning.Enabled {
+		return nil
+	}
+	params := &nodeTuningParameters{}
+	if !tuning.Privileged {
+		if tuning.Somaxconn != nil {
+			params.Sysctls = append(params.Sysctls, corev1.Sysctl{Name: "net.core.somaxconn", Value: fmt.Sprint(*tuning.Somaxconn)})
+		}
+		return params
+	}
+	var commands []string
+	if tuning.Somaxconn != nil {
+		commands = append(commands, fmt.Sprintf("sysctl -w net.core.somaxconn=%d", *tuning.Somaxconn))
+	}
+	if tuning.DisableTHP {
+		commands = append(commands,
+			"echo never > /sys/kernel/mm/transparent_hugepage/enabled",
+			"echo never > /sys/kernel/mm/transparent_hugepage/defrag")
+	}
+	if tuning.OvercommitMemory {
+		commands = append(commands, "sysctl -w vm.overcommit_memory=1")
+	}
+	if len(commands) == 0 {
+		return params
+	}
+	image := tuning.Image
+	if image == "" {
+		image = defaultPVCImage
+	}
+	privileged := true
+	params.Container = &corev1.Container{
+		Name:            nodeTuningContainerName,
+		Image:           image,
+		ImagePullPolicy: tuning.ImagePullPolicy,
+		Command:         []string{"/bin/sh", "-c", "set -e\n" + strings.Join(commands, "\n")},
+		SecurityContext: &corev1.SecurityContext{Privileged: &privileged},
+	}
+	return params
+}
+
+// 合并用户配置的PodSecurityContext与调优sysctls
+func mergePodSysctls(securityContext *corev1.PodSecurityContext, sysctls []corev1.Sysctl) *corev1.PodSecurityContext {
+	if len(sysctls) == 0 {
+		return securityContext
+	}
+	merged := &corev1.PodSecurityContext{}
+	if securityContext != nil {
+		merged = securityContext.DeepCopy()
+	}
+	for _, sysctl := range sysctls {
+		found := false
+		for _, existing := range merged.Sysctls {
+			if existing.Name == sysctl.Name {
+				found = true
+				break
+			}
+		}
+		// 用户显式设置的sysctl优先
+		if !found {
+			merged.Sysctls = append(merged.Sysctls, sysctl)
+		}
+	}
+	return merged
+}
+
+// 检查调优是否被集群策略拒绝，并更新NodeTuned状态
+func UpdateRedisNodeTuningCondition(cr *redisv1alpha1.Redis, cl client.Client) error {
+	tuning := cr.Spec.NodeTuning
+	if tuning == nil || !tuning.Enabled {
+		if meta.FindStatusCondition(cr.Status.Conditions, redisv1alpha1.ConditionNodeTuned) == nil {
+			return nil
+		}
+		meta.RemoveStatusCondition(&cr.Status.Conditions, redisv1alpha1.ConditionNodeTuned)
+		return cl.Status().Update(context.TODO(), cr)
+	}
+	condition, err := getNodeTuningCondition(cr)
+	if err != nil || condition == nil {
+		return err
+	}
+	condition.ObservedGeneration = cr.Generation
+	if existing := meta.FindStatusCondition(cr.Status.Conditions, condition.Type); existing != nil &&
+		existing.Status == condition.Status && existing.Reason == condition.Reason && existing.Message == condition.Message {
+		return nil
+	}
+	meta.SetStatusCondition(&cr.Status.Conditions, *condition)
+	if condition.Status == metav1.ConditionFalse {
+		redisLogger(cr.Namespace, cr.Name).Info("Redis node tuning is not applied", "reason", condition.Reason, "message", condition.Message)
+	}
+	return cl.Status().Update(context.TODO(), cr)
+}
+
+func getNodeTuningCondition(cr *redisv1alpha1.Redis) (*metav1.Condition, error) {
+	tuning := cr.Spec.NodeTuning
+	condition := &metav1.Condition{Type: redisv1alpha1.ConditionNodeTuned, Status: metav1.ConditionFalse}
+	if !tuning.Privileged && (tuning.DisableTHP || tuning.OvercommitMemory) {
+		condition.Reason = "PrivilegedRequired"
+		condition.Message = "disableTHP and overcommitMemory require spec.nodeTuning.privileged"
+		return condition, nil
+	}
+	pod, err := generateK8sClient().CoreV1().Pods(cr.Namespace).Get(context.TODO(), getRedisPodName(cr), metav1.GetOptions{})
+	if err != nil {
+		if !errors.IsNotFound(err) {
+			return nil, err
+		}
+		// pod不存在时检查statefulset是否因准入策略无法创建pod，正常重建期间保持原状态
+		message, err := getStatefulSetCreateFailure(cr)
+		if err != nil || message == "" {
+			return nil, err
+		}
+		condition.Reason = "PolicyRejected"
+		condition.Message = message
+		return condition, nil
+	}
+	// kubelet未放开unsafe sysctl时拒绝运行pod
+	if pod.Status.Reason == "SysctlForbidden" {
+		condition.Reason = "SysctlForbidden"
+		condition.Message = pod.Status.Message
+		return condition, nil
+	}
+	for _, status := range pod.Status.InitContainerStatuses {
+		if status.Name != nodeTuningContainerName {
+			continue
+		}
+		terminated := status.State.Terminated
+		if terminated == nil {
+			terminated = status.LastTerminationState.Terminated
+		}
+		if terminated != nil && terminated.ExitCode != 0 {
+			condition.Reason = "TuningFailed"
+			condition.Message = fmt.Sprintf("init container %s exited with code %d", nodeTuningContainerName, terminated.ExitCode)
+			return condition, nil
+		}
+	}
+	if pod.Status.Phase != corev1.PodRunning {
+		return nil, nil
+	}
+	condition.Status = metav1.ConditionTrue
+	condition.Reason = "Applied"
+	condition.Message = "node tuning applied"
+	return condition, nil
+}
+
+// 获取statefulset最近一次被拒绝创建pod的原因，只看最近仍在重试的FailedCreate事件
+func getStatefulSetCreateFailure(cr *redisv1alpha1.Redis) (string, error) {
+	events, err := generateK8sClient().CoreV1().Events(cr.Namespace).List(context.TODO(), metav1.ListOptions{
+		FieldSelector: fields.AndSelectors(
+			fields.OneTermEqualSelector("involvedObject.kind", "StatefulSet"),
+			fields.OneTermEqualSelector("involvedObject.name", cr.Name),
+			fields.OneTermEqualSelector("reason", "FailedCreate"),
+		).String(),
+	})
+	if err != nil {
+		return "", err
+	}
+	var latest *corev1.Event
+	for i := range events.Items {
+		event := &events.Items[i]
+		if latest == nil || getEventTime(event).After(getEventTime(latest)) {
+			latest = event
+		}
+	}
+	if latest == nil || time.Since(getEventTime(latest)) > createFailureWindow || !strings.Contains(latest.Message, "forbidden") {
+		return "", nil
+	}
+	return latest.Message, nil
+}
+
+// 事件最后一次发生的时间
+func getEventTime(event *corev1.Event) time.Time {
+	if !event.LastTimestamp.IsZero() {
+		return event.LastTimestamp.Time
+	}
+	if !event.EventTime.IsZero() {
+		return event.EventTime.Time
+	}
+	return event.CreationTimestamp.Time
+}
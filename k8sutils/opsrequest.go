@@ -0,0 +1,289 @@
+package k8sutils
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/go-logr/logr"
+	"github.com/go-redis/redis/v8"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	redisv1alpha1 "github.com/superwongo/redis-operator/api/v1alpha1"
+)
+
+func opsRequestLogger(namespace string, name string) logr.Logger {
+	reqLogger := log.Log.WithValues("Request.RedisOpsRequest.Namespace", namespace, "Request.RedisOpsRequest.Name", name)
+	return reqLogger
+}
+
+// 校验运维操作参数及前置条件
+func ValidateRedisOpsRequest(cr *redisv1alpha1.Redis, ops *redisv1alpha1.RedisOpsRequest) error {
+	switch ops.Spec.Type {
+	case redisv1alpha1.OpsRequestFailover, redisv1alpha1.OpsRequestBGSave, redisv1alpha1.OpsRequestBGRewriteAOF:
+		// 维护期间禁止故障切换及备份类操作
+		if IsRedisInMaintenance(cr) {
+			return fmt.Errorf("redis %s is in maintenance, %s is not allowed", cr.Name, ops.Spec.Type)
+		}
+	case redisv1alpha1.OpsRequestKillClients:
+		if ops.Spec.KillClients == nil {
+			return fmt.Errorf("spec.killClients is required for KillClients")
+		}
+	}
+	preconditions := ops.Spec.Preconditions
+	if preconditions == nil {
+		return nil
+	}
+	if preconditions.RequireHealthy && !meta.IsStatusConditionTrue(cr.Status.Conditions, redisv1alpha1.ConditionHealthy) {
+		return fmt.Errorf("precondition failed: redis %s is not healthy", cr.Name)
+	}
+	if preconditions.Role != "" {
+		role := ""
+		if cr.Status.Health != nil {
+			role = cr.Status.Health.Role
+		}
+		if role != preconditions.Role {
+			return fmt.Errorf("precondition failed: redis %s role is %q, expected %q", cr.Name, role, preconditions.Role)
+		}
+	}
+	return nil
+}
+
+// 执行前记录用于判断异步操作完成的基准状态，随Running状态一起持久化
+func PrepareRedisOpsRequest(cr *redisv1alpha1.Redis, ops *redisv1alpha1.RedisOpsRequest) error {
+	switch ops.Spec.Type {
+	case redisv1alpha1.OpsRequestRestart:
+		pod, err := generateK8sClient().CoreV1().Pods(cr.Namespace).Get(context.TODO(), getRedisPodName(cr), metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		ops.Status.PodUID = string(pod.UID)
+	case redisv1alpha1.OpsRequestBGSave:
+		rc, err := configureRedisClient(cr, getRedisPodName(cr))
+		if err != nil {
+			return err
+		}
+		defer rc.Close()
+		lastSave, err := rc.LastSave(context.TODO()).Result()
+		if err != nil {
+			return err
+		}
+		ops.Status.LastSave = lastSave
+	}
+	return nil
+}
+
+// 执行运维操作，返回操作是否已完成，未完成的操作通过CheckRedisOpsRequest跟踪
+func StartRedisOpsRequest(cr *redisv1alpha1.Redis, ops *redisv1alpha1.RedisOpsRequest) (bool, error) {
+	logger := opsRequestLogger(ops.Namespace, ops.Name)
+	logger.Info("Executing redis ops request", "redis", cr.Name, "type", ops.Spec.Type)
+	switch ops.Spec.Type {
+	case redisv1alpha1.OpsRequestRestart:
+		return false, restartRedisPod(cr, ops)
+	case redisv1alpha1.OpsRequestBGSave:
+		_, _, err := StartRedisBackupSave(cr)
+		return false, err
+	}
+
+	rc, err := configureRedisClient(cr, getRedisPodName(cr))
+	if err != nil {
+		return false, err
+	}
+	defer rc.Close()
+	ctx := context.TODO()
+	switch ops.Spec.Type {
+	case redisv1alpha1.OpsRequestBGRewriteAOF:
+		if err := rc.BgRewriteAOF(ctx).Err(); err != nil && !strings.Contains(err.Error(), "already in progress") {
+			return false, err
+		}
+		return false, nil
+	case redisv1alpha1.OpsRequestFailover:
+		info, err := rc.Info(ctx, "replication").Result()
+		if err != nil {
+			return false, err
+		}
+		if role := parseRedisInfo(info, "role"); role != "slave" {
+			return false, fmt.Errorf("redis %s is a %s without a primary to take over from", cr.Name, role)
+		}
+		err = rc.Do(ctx, "REPLICAOF", "NO", "ONE").Err()
+		RecordFailover(cr.Namespace, cr.Name, err)
+		if err != nil {
+			recordEvent(cr, corev1.EventTypeWarning, EventReasonFailoverFailed, "ops request %s failover failed: %v", ops.Name, err)
+			return false, err
+		}
+		recordEvent(cr, corev1.EventTypeNormal, EventReasonFailover, "promoted to primary by ops request %s", ops.Name)
+		ops.Status.Output = "promoted to primary"
+		return true, nil
+	case redisv1alpha1.OpsRequestFlush:
+		output, err := flushRedis(ctx, rc, ops.Spec.Flush)
+		ops.Status.Output = output
+		return err == nil, err
+	case redisv1alpha1.OpsRequestMemoryPurge:
+		before, err := rc.Info(ctx, "memory").Result()
+		if err != nil {
+			return false, err
+		}
+		if err := rc.Do(ctx, "MEMORY", "PURGE").Err(); err != nil {
+			return false, err
+		}
+		after, err := rc.Info(ctx, "memory").Result()
+		if err != nil {
+			return false, err
+		}
+		ops.Status.Output = fmt.Sprintf("used_memory_rss %s -> %s, mem_fragmentation_ratio %s -> %s",
+			parseRedisInfo(before, "used_memory_rss"), parseRedisInfo(after, "used_memory_rss"),
+			parseRedisInfo(before, "mem_fragmentation_ratio"), parseRedisInfo(after, "mem_fragmentation_ratio"))
+		return true, nil
+	case redisv1alpha1.OpsRequestKillClients:
+		killed, err := killRedisClients(ctx, rc, ops.Spec.KillClients)
+		ops.Status.Output = fmt.Sprintf("killed %d clients", killed)
+		return err == nil, err
+	}
+	return false, fmt.Errorf("unsupported ops request type %q", ops.Spec.Type)
+}
+
+// 检查异步运维操作是否已完成
+func CheckRedisOpsRequest(cr *redisv1alpha1.Redis, ops *redisv1alpha1.RedisOpsRequest) (bool, error) {
+	switch ops.Spec.Type {
+	case redisv1alpha1.OpsRequestRestart:
+		pod, err := generateK8sClient().CoreV1().Pods(cr.Namespace).Get(context.TODO(), getRedisPodName(cr), metav1.GetOptions{})
+		if err != nil {
+			if errors.IsNotFound(err) {
+				return false, nil
+			}
+			return false, err
+		}
+		if string(pod.UID) == ops.Status.PodUID || !isPodReady(pod) {
+			return false, nil
+		}
+		ops.Status.Output = fmt.Sprintf("pod %s recreated and ready", pod.Name)
+		return true, nil
+	case redisv1alpha1.OpsRequestBGSave:
+		saved, err := IsRedisBackupSaved(cr, ops.Status.LastSave)
+		if err != nil || !saved {
+			return false, err
+		}
+		ops.Status.Output = "background save completed"
+		return true, nil
+	case redisv1alpha1.OpsRequestBGRewriteAOF:
+		rc, err := configureRedisClient(cr, getRedisPodName(cr))
+		if err != nil {
+			return false, err
+		}
+		defer rc.Close()
+		info, err := rc.Info(context.TODO(), "persistence").Result()
+		if err != nil {
+			return false, err
+		}
+		if parseRedisInfo(info, "aof_rewrite_in_progress") != "0" || parseRedisInfo(info, "aof_rewrite_scheduled") != "0" {
+			return false, nil
+		}
+		if parseRedisInfo(info, "aof_last_bgrewrite_status") == "err" {
+			return false, fmt.Errorf("redis BGREWRITEAOF failed, check redis logs for details")
+		}
+		ops.Status.Output = "AOF rewrite completed"
+		return true, nil
+	}
+	// 同步操作执行后即结束，处于Running说明执行结果未能记录，无法确认是否已执行
+	return false, fmt.Errorf("outcome of %s is unknown, the operator restarted after it was started", ops.Spec.Type)
+}
+
+// 删除执行前记录的redis pod，pod已被重建时不再删除
+func restartRedisPod(cr *redisv1alpha1.Redis, ops *redisv1alpha1.RedisOpsRequest) error {
+	uid := types.UID(ops.Status.PodUID)
+	err := generateK8sClient().CoreV1().Pods(cr.Namespace).Delete(context.TODO(), getRedisPodName(cr), metav1.DeleteOptions{
+		Preconditions: &metav1.Preconditions{UID: &uid},
+	})
+	if errors.IsNotFound(err) || errors.IsConflict(err) {
+		return nil
+	}
+	return err
+}
+
+func isPodReady(pod *corev1.Pod) bool {
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == corev1.PodReady {
+			return condition.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// 清空指定DB或全部数据
+func flushRedis(ctx context.Context, rc *redis.Client, options *redisv1alpha1.FlushOptions) (string, error) {
+	if options == nil {
+		options = &redisv1alpha1.FlushOptions{}
+	}
+	if options.All {
+		if options.Async {
+			return "flushed all databases asynchronously", rc.FlushAllAsync(ctx).Err()
+		}
+		return "flushed all databases", rc.FlushAll(ctx).Err()
+	}
+	// FLUSHDB作用于当前连接选择的DB，需在同一连接上执行SELECT
+	conn := rc.Conn(ctx)
+	defer conn.Close()
+	if err := conn.Select(ctx, int(options.DB)).Err(); err != nil {
+		return "", err
+	}
+	if options.Async {
+		return fmt.Sprintf("flushed db %d asynchronously", options.DB), conn.FlushDBAsync(ctx).Err()
+	}
+	return fmt.Sprintf("flushed db %d", options.DB), conn.FlushDB(ctx).Err()
+}
+
+// 按条件断开客户端，返回断开的客户端数量，不会断开operator自身的连接
+func killRedisClients(ctx context.Context, rc *redis.Client, options *redisv1alpha1.KillClientsOptions) (int, error) {
+	args := []interface{}{"CLIENT", "LIST"}
+	if options.Type != "" {
+		args = append(args, "TYPE", options.Type)
+	}
+	list, err := rc.Do(ctx, args...).Text()
+	if err != nil {
+		return 0, err
+	}
+	self, err := rc.ClientID(ctx).Result()
+	if err != nil {
+		return 0, err
+	}
+	killed := 0
+	for _, line := range strings.Split(strings.TrimSpace(list), "\n") {
+		fields := parseRedisClientInfo(line)
+		if fields["id"] == "" || fields["id"] == strconv.FormatInt(self, 10) {
+			continue
+		}
+		if options.User != "" && fields["user"] != options.User {
+			continue
+		}
+		if options.Addr != "" && fields["addr"] != options.Addr {
+			continue
+		}
+		if idle, _ := strconv.ParseInt(fields["idle"], 10, 64); idle < options.MinIdleSeconds {
+			continue
+		}
+		// 客户端可能已自行断开
+		n, err := rc.ClientKillByFilter(ctx, "ID", fields["id"]).Result()
+		if err != nil && !strings.Contains(err.Error(), "No such client") {
+			return killed, err
+		}
+		killed += int(n)
+	}
+	return killed, nil
+}
+
+// 解析CLIENT LIST中的一行，格式为key=value并以空格分隔
+func parseRedisClientInfo(line string) map[string]string {
+	fields := map[string]string{}
+	for _, field := range strings.Fields(line) {
+		if key, value, found := strings.Cut(field, "="); found {
+			fields[key] = value
+		}
+	}
+	return fields
+}
@@ -0,0 +1,56 @@
+package k8sutils
+
+import (
+	"reflect"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	redisv1alpha1 "github.com/superwongo/redis-operator/api/v1alpha1"
+)
+
+func TestValidateRedisOpsRequestMaintenance(t *testing.T) {
+	cr := &redisv1alpha1.Redis{ObjectMeta: metav1.ObjectMeta{Name: "cache", Annotations: map[string]string{RedisMaintenanceAnnotation: "true"}}}
+	tests := []struct {
+		opsType redisv1alpha1.OpsRequestType
+		wantErr bool
+	}{
+		{opsType: redisv1alpha1.OpsRequestFailover, wantErr: true},
+		{opsType: redisv1alpha1.OpsRequestBGSave, wantErr: true},
+		{opsType: redisv1alpha1.OpsRequestBGRewriteAOF, wantErr: true},
+		{opsType: redisv1alpha1.OpsRequestMemoryPurge},
+		{opsType: redisv1alpha1.OpsRequestRestart},
+	}
+	for _, tt := range tests {
+		ops := &redisv1alpha1.RedisOpsRequest{Spec: redisv1alpha1.RedisOpsRequestSpec{Type: tt.opsType}}
+		err := ValidateRedisOpsRequest(cr, ops)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: ValidateRedisOpsRequest() error = %v, wantErr %v", tt.opsType, err, tt.wantErr)
+		}
+	}
+}
+
+func TestParseRedisClientInfo(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+		want map[string]string
+	}{
+		{name: "empty line", line: "", want: map[string]string{}},
+		{
+			name: "client list entry",
+			line: "id=3 addr=10.0.0.5:52214 laddr=10.0.0.9:6379 fd=8 name= age=12 idle=3 flags=N db=0 user=app cmd=get",
+			want: map[string]string{
+				"id": "3", "addr": "10.0.0.5:52214", "laddr": "10.0.0.9:6379", "fd": "8", "name": "",
+				"age": "12", "idle": "3", "flags": "N", "db": "0", "user": "app", "cmd": "get",
+			},
+		},
+		{name: "value containing equals sign", line: "id=7 lib-name=a=b", want: map[string]string{"id": "7", "lib-name": "a=b"}},
+		{name: "field without value", line: "id=9 garbage\r", want: map[string]string{"id": "9"}},
+	}
+	for _, tt := range tests {
+		if got := parseRedisClientInfo(tt.line); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: parseRedisClientInfo() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
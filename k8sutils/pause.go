@@ -0,0 +1,102 @@
+package k8sutils
+
+import (
+	"context"
+	"encoding/json"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	redisv1alpha1 "github.com/superwongo/redis-operator/api/v1alpha1"
+)
+
+const (
+	// 设置为true时operator不再修改受管对象，仅更新状态
+	RedisPausedAnnotation = "redis.superwongo.com/paused"
+	// 设置为true时在暂停的基础上禁止故障切换及备份
+	RedisMaintenanceAnnotation = "redis.superwongo.com/maintenance"
+)
+
+// 是否处于维护模式
+func IsRedisInMaintenance(cr *redisv1alpha1.Redis) bool {
+	return cr.Annotations[RedisMaintenanceAnnotation] == "true"
+}
+
+// 是否暂停协调，维护模式同样暂停协调
+func IsRedisPaused(cr *redisv1alpha1.Redis) bool {
+	return cr.Annotations[RedisPausedAnnotation] == "true" || IsRedisInMaintenance(cr)
+}
+
+// 将维护模式同步到redis pod注解，preStop通过downward API读取，直接修改pod注解不会触发重启
+func SyncRedisMaintenanceAnnotation(cr *redisv1alpha1.Redis) error {
+	pods := generateK8sClient().CoreV1().Pods(cr.Namespace)
+	pod, err := pods.Get(context.TODO(), getRedisPodName(cr), metav1.GetOptions{})
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	inMaintenance := IsRedisInMaintenance(cr)
+	if (pod.Annotations[RedisMaintenanceAnnotation] == "true") == inMaintenance {
+		return nil
+	}
+	var value interface{}
+	if inMaintenance {
+		value = "true"
+	}
+	data, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]interface{}{RedisMaintenanceAnnotation: value},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	if _, err := pods.Patch(context.TODO(), pod.Name, types.MergePatchType, data, metav1.PatchOptions{}); err != nil {
+		return err
+	}
+	redisLogger(cr.Namespace, cr.Name).Info("Synced maintenance annotation to redis pod", "pod", pod.Name, "maintenance", inMaintenance)
+	return nil
+}
+
+// 更新Paused状态，进入或退出暂停时发送事件
+func UpdateRedisPausedCondition(cr *redisv1alpha1.Redis, cl client.Client) error {
+	condition := metav1.Condition{
+		Type:               redisv1alpha1.ConditionPaused,
+		Status:             metav1.ConditionFalse,
+		Reason:             "Reconciling",
+		ObservedGeneration: cr.Generation,
+	}
+	switch {
+	case IsRedisInMaintenance(cr):
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = "Maintenance"
+		condition.Message = "reconciliation, failovers and backups are suspended"
+	case IsRedisPaused(cr):
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = "Paused"
+		condition.Message = "reconciliation is suspended, only status is updated"
+	}
+	existing := meta.FindStatusCondition(cr.Status.Conditions, condition.Type)
+	if existing == nil && condition.Status == metav1.ConditionFalse {
+		return nil
+	}
+	if existing != nil && existing.Status == condition.Status && existing.Reason == condition.Reason {
+		return nil
+	}
+	logger := redisLogger(cr.Namespace, cr.Name)
+	if condition.Status == metav1.ConditionTrue {
+		logger.Info("Redis reconciliation suspended", "reason", condition.Reason)
+		recordEvent(cr, corev1.EventTypeNormal, EventReasonPaused, "%s", condition.Message)
+	} else {
+		logger.Info("Redis reconciliation resumed")
+		recordEvent(cr, corev1.EventTypeNormal, EventReasonResumed, "reconciliation resumed")
+	}
+	meta.SetStatusCondition(&cr.Status.Conditions, condition)
+	return cl.Status().Update(context.TODO(), cr)
+}
@@ -0,0 +1,150 @@
+package k8sutils
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/banzaicloud/k8s-objectmatcher/patch"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	redisv1alpha1 "github.com/superwongo/redis-operator/api/v1alpha1"
+)
+
+func pdbLogger(namespace string, name string) logr.Logger {
+	reqLogger := log.Log.WithValues("Request.PodDisruptionBudget.Namespace", namespace, "Request.PodDisruptionBudget.Name", name)
+	return reqLogger
+}
+
+// 创建或更新redis单例PodDisruptionBudget，未启用时删除
+// 单例只有一个pod，maxUnavailable=1不起保护作用，minAvailable=1又会阻塞节点排空，因此未设置两者时不创建
+func ReconcileStandalonePodDisruptionBudget(cr *redisv1alpha1.Redis) error {
+	pdbSpec := cr.Spec.PodDisruptionBudget
+	if pdbSpec == nil || !pdbSpec.Enabled {
+		return deletePodDisruptionBudget(cr.Namespace, cr.Name, redisAsOwner(cr))
+	}
+	if pdbSpec.MinAvailable == nil && pdbSpec.MaxUnavailable == nil {
+		pdbLogger(cr.Namespace, cr.Name).Info("Skipping PodDisruptionBudget for standalone redis without minAvailable or maxUnavailable")
+		recordEvent(cr, corev1.EventTypeWarning, EventReasonPDBSkipped,
+			"spec.podDisruptionBudget is enabled but a standalone redis has a single pod, set minAvailable: 1 to block voluntary evictions")
+		return deletePodDisruptionBudget(cr.Namespace, cr.Name, redisAsOwner(cr))
+	}
+	labels := getRedisLabels(cr.ObjectMeta.Name, "standalone", "standalone", cr.ObjectMeta.Labels)
+	objectMetaInfo := generateObjectMetaInformation(cr.ObjectMeta.Name, cr.Namespace, labels, generateObjectAnots(cr.ObjectMeta))
+	return CreateOrUpdatePodDisruptionBudget(cr.Namespace, objectMetaInfo, pdbSpec, redisAsOwner(cr))
+}
+
+func CreateOrUpdatePodDisruptionBudget(namespace string, pdbMeta metav1.ObjectMeta, pdbSpec *redisv1alpha1.RedisPodDisruptionBudget, ownerRef metav1.OwnerReference) error {
+	logger := pdbLogger(namespace, pdbMeta.GetName())
+	pdbDef, err := generatePodDisruptionBudgetDef(pdbMeta, pdbSpec, ownerRef)
+	if err != nil {
+		logger.Error(err, "Invalid redis PodDisruptionBudget configuration")
+		return err
+	}
+	storedPDB, err := generateK8sClient().PolicyV1().PodDisruptionBudgets(namespace).Get(context.TODO(), pdbMeta.GetName(), metav1.GetOptions{})
+	if err != nil {
+		if errors.IsNotFound(err) {
+			if err := patch.DefaultAnnotator.SetLastAppliedAnnotation(pdbDef); err != nil {
+				logger.Error(err, "Unable to patch redis PodDisruptionBudget with comparison object")
+				return err
+			}
+			_, err = generateK8sClient().PolicyV1().PodDisruptionBudgets(namespace).Create(context.TODO(), pdbDef, metav1.CreateOptions{})
+			if err != nil {
+				logger.Error(err, "Redis PodDisruptionBudget creation failed")
+				recordOwnerEvent(pdbDef, "PodDisruptionBudget", corev1.EventTypeWarning, EventReasonCreateFailed, "%v", err)
+				return err
+			}
+			recordOwnerEvent(pdbDef, "PodDisruptionBudget", corev1.EventTypeNormal, EventReasonCreated, "created")
+			logger.Info("Redis PodDisruptionBudget creation was successful")
+			return nil
+		}
+		return err
+	}
+	return patchPodDisruptionBudget(namespace, storedPDB, pdbDef)
+}
+
+// 初始化PodDisruptionBudget声明，按redis label选择pod
+func generatePodDisruptionBudgetDef(pdbMeta metav1.ObjectMeta, pdbSpec *redisv1alpha1.RedisPodDisruptionBudget, ownerRef metav1.OwnerReference) (*policyv1.PodDisruptionBudget, error) {
+	if pdbSpec.MinAvailable != nil && pdbSpec.MaxUnavailable != nil {
+		return nil, fmt.Errorf("only one of minAvailable and maxUnavailable can be set in spec.podDisruptionBudget")
+	}
+	if pdbSpec.MinAvailable == nil && pdbSpec.MaxUnavailable == nil {
+		return nil, fmt.Errorf("one of minAvailable and maxUnavailable is required in spec.podDisruptionBudget")
+	}
+	pdb := &policyv1.PodDisruptionBudget{
+		TypeMeta:   generateMetaInformation("PodDisruptionBudget", "policy/v1"),
+		ObjectMeta: pdbMeta,
+		Spec: policyv1.PodDisruptionBudgetSpec{
+			Selector:       labelSelector(pdbMeta.GetLabels()),
+			MinAvailable:   pdbSpec.MinAvailable,
+			MaxUnavailable: pdbSpec.MaxUnavailable,
+		},
+	}
+	AddOwnerRefToObject(pdb, ownerRef)
+	return pdb, nil
+}
+
+func patchPodDisruptionBudget(namespace string, storedPDB *policyv1.PodDisruptionBudget, newPDB *policyv1.PodDisruptionBudget) error {
+	logger := pdbLogger(namespace, newPDB.GetName())
+	newPDB.ResourceVersion = storedPDB.ResourceVersion
+	newPDB.CreationTimestamp = storedPDB.CreationTimestamp
+	newPDB.ManagedFields = storedPDB.ManagedFields
+	patchResult, err := patch.DefaultPatchMaker.Calculate(storedPDB, newPDB,
+		patch.IgnoreStatusFields(),
+		patch.IgnoreField("kind"),
+		patch.IgnoreField("apiVersion"),
+	)
+	if err != nil {
+		logger.Error(err, "Unable to patch redis PodDisruptionBudget with comparison object")
+		return err
+	}
+	if patchResult.IsEmpty() {
+		logger.Info("Redis PodDisruptionBudget is already in-sync")
+		return nil
+	}
+	logger.Info("Changes in PodDisruptionBudget Detected, Updating...", "patch", string(patchResult.Patch))
+	recordManagedUpdate("PodDisruptionBudget", storedPDB, newPDB)
+	for k, v := range storedPDB.Annotations {
+		if _, present := newPDB.Annotations[k]; !present {
+			newPDB.Annotations[k] = v
+		}
+	}
+	if err := patch.DefaultAnnotator.SetLastAppliedAnnotation(newPDB); err != nil {
+		logger.Error(err, "Unable to patch redis PodDisruptionBudget with comparison object")
+		return err
+	}
+	_, err = generateK8sClient().PolicyV1().PodDisruptionBudgets(namespace).Update(context.TODO(), newPDB, metav1.UpdateOptions{})
+	if err != nil {
+		logger.Error(err, "Redis PodDisruptionBudget update failed")
+		recordOwnerEvent(newPDB, "PodDisruptionBudget", corev1.EventTypeWarning, EventReasonUpdateFailed, "%v", err)
+		return err
+	}
+	recordOwnerEvent(newPDB, "PodDisruptionBudget", corev1.EventTypeNormal, EventReasonUpdated, "changed %s", summarizePatch(patchResult.Patch))
+	logger.Info("Redis PodDisruptionBudget update successfully")
+	return nil
+}
+
+// 删除不再需要的PodDisruptionBudget，不删除非operator创建的同名对象
+func deletePodDisruptionBudget(namespace string, name string, ownerRef metav1.OwnerReference) error {
+	pdbs := generateK8sClient().PolicyV1().PodDisruptionBudgets(namespace)
+	storedPDB, err := pdbs.Get(context.TODO(), name, metav1.GetOptions{})
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	if !isOwnedBy(storedPDB, ownerRef) {
+		return nil
+	}
+	err = pdbs.Delete(context.TODO(), name, metav1.DeleteOptions{Preconditions: &metav1.Preconditions{UID: &storedPDB.UID}})
+	if err != nil && !errors.IsNotFound(err) {
+		pdbLogger(namespace, name).Error(err, "Could not delete redis PodDisruptionBudget")
+		return err
+	}
+	return nil
+}
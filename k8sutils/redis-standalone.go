@@ -1,6 +1,9 @@
 package k8sutils
 
 import (
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
 	redisv1alpha1 "github.com/superwongo/redis-operator/api/v1alpha1"
 )
 
@@ -8,21 +11,88 @@ var (
 	enabledMetrics bool
 )
 
-func CreateStandaloneRedis(cr *redisv1alpha1.Redis) error {
+func CreateStandaloneRedis(cr *redisv1alpha1.Redis, cl client.Client) error {
 	logger := statefulSetLogger(cr.Namespace, cr.ObjectMeta.Name)
+	// 校验所选引擎是否支持当前配置
+	if err := validateRedisFlavor(cr); err != nil {
+		logger.Error(err, "Unsupported configuration for Redis flavor")
+		recordEvent(cr, corev1.EventTypeWarning, EventReasonValidationFailed, "%v", err)
+		return err
+	}
+	if err := validateRedisTLS(cr); err != nil {
+		logger.Error(err, "Invalid TLS configuration for Redis")
+		recordEvent(cr, corev1.EventTypeWarning, EventReasonValidationFailed, "%v", err)
+		return err
+	}
+	params := generateRedisStandaloneParams(cr)
+	// 设置数据恢复init容器
+	restore, err := generateRestoreParams(cr, cl)
+	if err != nil {
+		logger.Error(err, "Cannot generate restore init container for Redis")
+		return err
+	}
+	params.Restore = restore
+	containerParams := generateRedisStandaloneContainerParams(cr)
+	// 镜像变更需先通过版本校验及升级前备份
+	containerParams.Image, err = ReconcileRedisUpgrade(cr, cl)
+	if err != nil {
+		logger.Error(err, "Cannot reconcile image upgrade for Redis")
+		return err
+	}
+	// 设置模块下载init容器，在用户自定义init容器之前执行
+	modules, err := generateModuleParams(cr)
+	if err != nil {
+		logger.Error(err, "Invalid modules for Redis")
+		return err
+	}
+	params.InitContainers = append(modules.InitContainers, params.InitContainers...)
+	params.Volumes = append(modules.Volumes, params.Volumes...)
+	containerParams.AdditionalMounts = append(modules.VolumeMounts, containerParams.AdditionalMounts...)
 	// 设置redis单例label
 	labels := getRedisLabels(cr.ObjectMeta.Name, "standalone", "standalone", cr.ObjectMeta.Labels)
+	// 生成redis配置，用户配置与operator生成的配置合并后挂载
+	configHash, err := CreateOrUpdateRedisConfig(cr, cl, labels)
+	if err != nil {
+		logger.Error(err, "Cannot create redis config for Redis")
+		return err
+	}
+	configMapName := getRedisConfigMapName(cr)
+	params.ExternalConfig = &configMapName
+	params.ConfigHash = configHash
+	// 非redis引擎的密码写入operator管理的secret，密码变化时同样触发重启
+	authHash, err := CreateOrUpdateRedisAuthConfig(cr, labels)
+	if err != nil {
+		logger.Error(err, "Cannot create auth config for Redis")
+		return err
+	}
+	if authHash != "" {
+		authSecretName := getRedisAuthConfigSecretName(cr)
+		containerParams.AuthConfigSecret = &authSecretName
+		params.ConfigHash = getRedisConfigHash(map[string]string{"config": configHash, "auth": authHash})
+	}
+	// 签发或续签TLS证书，cert-manager证书未就绪前不创建statefulset
+	params.TLSCertHash, err = ReconcileRedisTLS(cr)
+	if err != nil {
+		logger.Error(err, "Cannot issue TLS certificate for Redis")
+		return err
+	}
+	// 到达重启时间后更新pod模板注解，触发重启
+	params.RestartAt, err = getRedisRestartAt(cr)
+	if err != nil {
+		logger.Error(err, "Cannot read restartAt of Redis statefulset")
+		return err
+	}
 	// 设置redis单例annotation
 	anots := generateObjectAnots(cr.ObjectMeta)
 	// 设置redis单例Meta数据
 	objectMetaInfo := generateObjectMetaInformation(cr.ObjectMeta.Name, cr.Namespace, labels, anots)
 	// 创建或更新redis单例
-	err := CreateOrUpdateStateful(
+	err = CreateOrUpdateStateful(
 		cr.Namespace,
 		objectMetaInfo,
-		generateRedisStandaloneParams(cr),
+		params,
 		redisAsOwner(cr),
-		generateRedisStandaloneContainerParams(cr),
+		containerParams,
 		cr.Spec.Sidecars,
 	)
 	if err != nil {
@@ -49,8 +119,17 @@ func generateRedisStandaloneParams(cr *redisv1alpha1.Redis) statefulSetParameter
 	if cr.Spec.RedisStorage != nil {
 		res.PersistentVolumeClaim = cr.Spec.RedisStorage.VolumeClaimTemplate
 	}
-	if cr.Spec.RedisConfig != nil {
-		res.ExternalConfig = cr.Spec.RedisConfig.AdditionalRedisConfig
+	if cr.Spec.InitContainers != nil {
+		res.InitContainers = cr.Spec.InitContainers
+	}
+	if cr.Spec.Volumes != nil {
+		res.Volumes = cr.Spec.Volumes
+	}
+	if cr.Spec.NodeTuning != nil {
+		res.NodeTuning = generateNodeTuningParams(cr)
+	}
+	if cr.Spec.TerminationGracePeriodSeconds != nil {
+		res.GracePeriodSeconds = cr.Spec.TerminationGracePeriodSeconds
 	}
 	if cr.Spec.RedisExporter != nil {
 		res.EnabledMetrics = cr.Spec.RedisExporter.Enabled
@@ -64,9 +143,10 @@ func generateRedisStandaloneContainerParams(cr *redisv1alpha1.Redis) containerPa
 	falseProperty := false
 	containerProp := containerParameters{
 		Role:            "standalone",
-		Image:           cr.Spec.KubernetesConfig.Image,
+		Image:           getRedisImage(cr),
 		ImagePullPolicy: cr.Spec.KubernetesConfig.ImagePullPolicy,
 		Resources:       cr.Spec.KubernetesConfig.Resources,
+		Flavor:          getRedisFlavor(cr),
 	}
 	if cr.Spec.KubernetesConfig.ExistingPasswordSecret != nil {
 		containerProp.EnabledPassword = &trueProperty
@@ -84,6 +164,9 @@ func generateRedisStandaloneContainerParams(cr *redisv1alpha1.Redis) containerPa
 		if cr.Spec.RedisExporter.EnvVars != nil {
 			containerProp.RedisExporterEnvs = cr.Spec.RedisExporter.EnvVars
 		}
+		if monitor := cr.Spec.RedisExporter.Monitor; monitor != nil && monitor.Enabled && monitor.TLS != nil {
+			containerProp.RedisExporterTLS = true
+		}
 	}
 	if cr.Spec.ReadinessProbe != nil {
 		containerProp.ReadinessProbe = cr.Spec.ReadinessProbe
@@ -94,6 +177,10 @@ func generateRedisStandaloneContainerParams(cr *redisv1alpha1.Redis) containerPa
 	if cr.Spec.RedisStorage != nil {
 		containerProp.PersistenceEnabled = &trueProperty
 	}
+	containerProp.TLSConfig = getRedisTLSSpec(cr)
+	if cr.Spec.VolumeMounts != nil {
+		containerProp.AdditionalMounts = cr.Spec.VolumeMounts
+	}
 	return containerProp
 }
 
@@ -111,13 +198,14 @@ func CreateStandaloneService(cr *redisv1alpha1.Redis) error {
 	// 初始化svc headless对象元数据
 	headlessObjectMetaInfo := generateObjectMetaInformation(cr.ObjectMeta.Name+"-headless", cr.Namespace, labels, annotations)
 	// 创建或更新headless svc
-	err := CreateOrUpdateService(cr.Namespace, headlessObjectMetaInfo, redisAsOwner(cr), false, true)
+	plaintextPort := getPlaintextPort(getRedisTLSSpec(cr))
+	err := CreateOrUpdateService(cr.Namespace, headlessObjectMetaInfo, redisAsOwner(cr), false, true, plaintextPort)
 	if err != nil {
 		logger.Error(err, "Cannot create standalone headless service for Redis")
 		return err
 	}
 	// 创建或更新svc
-	err = CreateOrUpdateService(cr.Namespace, objectMetaInfo, redisAsOwner(cr), enabledMetrics, false)
+	err = CreateOrUpdateService(cr.Namespace, objectMetaInfo, redisAsOwner(cr), enabledMetrics, false, plaintextPort)
 	if err != nil {
 		logger.Error(err, "Cannot create standalone service for Redis")
 		return err
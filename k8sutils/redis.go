@@ -0,0 +1,169 @@
+package k8sutils
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/go-logr/logr"
+	"github.com/go-redis/redis/v8"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	redisv1alpha1 "github.com/superwongo/redis-operator/api/v1alpha1"
+)
+
+func redisLogger(namespace string, name string) logr.Logger {
+	reqLogger := log.Log.WithValues("Request.Redis.Namespace", namespace, "Request.Redis.Name", name)
+	return reqLogger
+}
+
+// 获取redis单例pod名称
+func getRedisPodName(cr *redisv1alpha1.Redis) string {
+	return cr.Name + "-0"
+}
+
+// pod在headless service下的域名，包含在operator签发的证书中
+func getRedisPodDNSName(cr *redisv1alpha1.Redis, podName string) string {
+	return podName + "." + cr.Name + "-headless." + cr.Namespace + ".svc"
+}
+
+// 通过pod查询redis服务地址
+func getRedisServerIP(namespace string, podName string) (string, error) {
+	logger := redisLogger(namespace, podName)
+	pod, err := generateK8sClient().CoreV1().Pods(namespace).Get(context.TODO(), podName, metav1.GetOptions{})
+	if err != nil {
+		logger.Error(err, "Error in getting redis pod IP")
+		return "", err
+	}
+	if pod.Status.PodIP == "" {
+		return "", fmt.Errorf("redis pod %s has no IP assigned", podName)
+	}
+	return pod.Status.PodIP, nil
+}
+
+// 查询redis密码
+func getRedisPassword(namespace string, name string, key string) (string, error) {
+	logger := redisLogger(namespace, name)
+	secret, err := generateK8sClient().CoreV1().Secrets(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+	if err != nil {
+		logger.Error(err, "Failed in getting existing secret for redis")
+		return "", err
+	}
+	value, ok := secret.Data[key]
+	if !ok {
+		return "", fmt.Errorf("key %s not found in secret %s", key, name)
+	}
+	return strings.TrimSpace(string(value)), nil
+}
+
+// 根据TLS配置初始化客户端证书，服务端证书需由CA签发且包含serverNames中任一域名
+func getRedisTLSConfig(cr *redisv1alpha1.Redis, serverNames []string) (*tls.Config, error) {
+	tlsSpec := getRedisTLSSpec(cr)
+	if tlsSpec == nil {
+		return nil, nil
+	}
+	secret, err := generateK8sClient().CoreV1().Secrets(cr.Namespace).Get(context.TODO(), tlsSpec.Secret.SecretName, metav1.GetOptions{})
+	if err != nil {
+		redisLogger(cr.Namespace, cr.Name).Error(err, "Failed in getting TLS secret for redis")
+		return nil, err
+	}
+	caCert, tlsCert, tlsCertKey := "ca.crt", "tls.crt", "tls.key"
+	if tlsSpec.CaKeyFile != "" {
+		caCert = tlsSpec.CaKeyFile
+	}
+	if tlsSpec.CertKeyFile != "" {
+		tlsCert = tlsSpec.CertKeyFile
+	}
+	if tlsSpec.KeyFile != "" {
+		tlsCertKey = tlsSpec.KeyFile
+	}
+	cert, err := tls.X509KeyPair(secret.Data[tlsCert], secret.Data[tlsCertKey])
+	if err != nil {
+		return nil, err
+	}
+	caPool := x509.NewCertPool()
+	if !caPool.AppendCertsFromPEM(secret.Data[caCert]) {
+		return nil, fmt.Errorf("no valid CA certificate found in secret %s", secret.Name)
+	}
+	// 标准校验只接受单个ServerName，跳过后在VerifyConnection中按证书链及多个域名校验
+	return &tls.Config{
+		Certificates:       []tls.Certificate{cert},
+		RootCAs:            caPool,
+		InsecureSkipVerify: true,
+		VerifyConnection: func(state tls.ConnectionState) error {
+			return verifyRedisServerCertificate(state, caPool, serverNames)
+		},
+	}, nil
+}
+
+// 校验服务端证书链，并要求证书包含任一允许的域名
+func verifyRedisServerCertificate(state tls.ConnectionState, caPool *x509.CertPool, serverNames []string) error {
+	if len(state.PeerCertificates) == 0 {
+		return fmt.Errorf("redis server did not present a certificate")
+	}
+	intermediates := x509.NewCertPool()
+	for _, cert := range state.PeerCertificates[1:] {
+		intermediates.AddCert(cert)
+	}
+	leaf := state.PeerCertificates[0]
+	if _, err := leaf.Verify(x509.VerifyOptions{Roots: caPool, Intermediates: intermediates}); err != nil {
+		return err
+	}
+	for _, name := range serverNames {
+		if leaf.VerifyHostname(name) == nil {
+			return nil
+		}
+	}
+	return fmt.Errorf("redis server certificate is not valid for any of %s", strings.Join(serverNames, ", "))
+}
+
+// 校验服务端证书时接受的域名：pod域名及service域名
+func getRedisServerNames(cr *redisv1alpha1.Redis, podName string) []string {
+	return []string{
+		getRedisPodDNSName(cr, podName),
+		cr.Name,
+		cr.Name + "." + cr.Namespace,
+		cr.Name + "." + cr.Namespace + ".svc",
+		cr.Name + "." + cr.Namespace + ".svc.cluster.local",
+	}
+}
+
+// 初始化redis客户端
+func configureRedisClient(cr *redisv1alpha1.Redis, podName string) (*redis.Client, error) {
+	ip, err := getRedisServerIP(cr.Namespace, podName)
+	if err != nil {
+		return nil, err
+	}
+	opts := &redis.Options{
+		Addr: net.JoinHostPort(ip, strconv.Itoa(redisPort)),
+		DB:   0,
+	}
+	if cr.Spec.KubernetesConfig.ExistingPasswordSecret != nil {
+		secret := cr.Spec.KubernetesConfig.ExistingPasswordSecret
+		opts.Password, err = getRedisPassword(cr.Namespace, *secret.Name, *secret.Key)
+		if err != nil {
+			return nil, err
+		}
+	}
+	// 通过pod IP访问，证书包含headless service下的pod域名或service域名均可
+	opts.TLSConfig, err = getRedisTLSConfig(cr, getRedisServerNames(cr, podName))
+	if err != nil {
+		return nil, err
+	}
+	return redis.NewClient(opts), nil
+}
+
+// 解析INFO命令返回的指定字段
+func parseRedisInfo(info string, key string) string {
+	for _, line := range strings.Split(info, "\r\n") {
+		if strings.HasPrefix(line, key+":") {
+			return strings.TrimPrefix(line, key+":")
+		}
+	}
+	return ""
+}
@@ -0,0 +1,80 @@
+package k8sutils
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	redisv1alpha1 "github.com/superwongo/redis-operator/api/v1alpha1"
+)
+
+func newTestCA(t *testing.T) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ca, key
+}
+
+func TestVerifyRedisServerCertificate(t *testing.T) {
+	cr := &redisv1alpha1.Redis{ObjectMeta: metav1.ObjectMeta{Name: "cache", Namespace: "apps"}}
+	serverNames := getRedisServerNames(cr, "cache-0")
+	ca, caKey := newTestCA(t)
+	otherCA, otherKey := newTestCA(t)
+	caPool := x509.NewCertPool()
+	caPool.AddCert(ca)
+
+	tests := []struct {
+		name     string
+		ca       *x509.Certificate
+		caKey    *ecdsa.PrivateKey
+		dnsNames []string
+		wantErr  bool
+	}{
+		{name: "service name", ca: ca, caKey: caKey, dnsNames: []string{"cache.apps.svc"}},
+		{name: "fully qualified service name", ca: ca, caKey: caKey, dnsNames: []string{"cache.apps.svc.cluster.local"}},
+		{name: "pod name", ca: ca, caKey: caKey, dnsNames: []string{"cache-0.cache-headless.apps.svc"}},
+		{name: "wildcard pod name", ca: ca, caKey: caKey, dnsNames: []string{"*.cache-headless.apps.svc"}},
+		{name: "unrelated name", ca: ca, caKey: caKey, dnsNames: []string{"other.apps.svc"}, wantErr: true},
+		{name: "untrusted CA", ca: otherCA, caKey: otherKey, dnsNames: []string{"cache.apps.svc"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		certPEM, _, err := issueCertificate(tt.ca, tt.caKey, "cache", tt.dnsNames, nil, []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}, time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cert, err := parseCertificate(certPEM)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = verifyRedisServerCertificate(tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}, caPool, serverNames)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: verifyRedisServerCertificate() error = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
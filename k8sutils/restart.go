@@ -0,0 +1,46 @@
+package k8sutils
+
+import (
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+
+	redisv1alpha1 "github.com/superwongo/redis-operator/api/v1alpha1"
+)
+
+const (
+	// 重启时间，写入pod模板注解，变化时触发滚动重启
+	RedisRestartAtAnnotation = "redis.superwongo.com/restart-at"
+)
+
+// 计算pod模板中的重启时间，取spec.restartAt与注解中较晚的一个，时间未到时沿用当前值
+// 单例模式下statefulset只有一个pod，重启期间服务短暂不可用
+// 时间未到且读取statefulset失败时返回错误，避免以空值覆盖当前重启时间而提前触发重启
+func getRedisRestartAt(cr *redisv1alpha1.Redis) (string, error) {
+	var restartAt time.Time
+	if cr.Spec.RestartAt != nil {
+		restartAt = cr.Spec.RestartAt.Time
+	}
+	if value, ok := cr.Annotations[RedisRestartAtAnnotation]; ok {
+		annotated, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			redisLogger(cr.Namespace, cr.Name).Info("Ignoring invalid restartAt annotation, expected RFC3339", "value", value)
+		} else if annotated.After(restartAt) {
+			restartAt = annotated
+		}
+	}
+	if restartAt.IsZero() {
+		return "", nil
+	}
+	if restartAt.After(time.Now()) {
+		sts, err := GetStatefulSet(cr.Namespace, cr.Name)
+		if apierrors.IsNotFound(err) {
+			return "", nil
+		}
+		if err != nil {
+			return "", err
+		}
+		return sts.Spec.Template.Annotations[RedisRestartAtAnnotation], nil
+	}
+	return restartAt.UTC().Format(time.RFC3339), nil
+}
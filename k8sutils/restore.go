@@ -0,0 +1,272 @@
+package k8sutils
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	redisv1alpha1 "github.com/superwongo/redis-operator/api/v1alpha1"
+)
+
+const (
+	restoreContainerName = "restore"
+	restoreMountPath     = "/restore"
+	defaultURLImage      = "curlimages/curl:8.11.1"
+)
+
+// 恢复前检查数据卷：已从同一来源恢复过则跳过，非空且未强制覆盖则拒绝恢复
+const restorePreludeScript = `set -e
+MARKER=${REDIS_DATA_PATH}/.restored-from
+result() {
+  printf '{"restored":%s,"reason":"%s","size":%s,"checksum":"%s"}' "$1" "$2" "${3:-0}" "$4" > ` + backupTerminalLog + `
+}
+if [ -f "${MARKER}" ] && [ "$(cat ${MARKER})" = "${RESTORE_SOURCE}" ]; then
+  result true AlreadyRestored
+  exit 0
+fi
+if [ -n "$(ls -A ${REDIS_DATA_PATH} | grep -v '^lost+found$')" ]; then
+  if [ "${RESTORE_FORCE}" != "true" ]; then
+    result false VolumeNotEmpty
+    exit 0
+  fi
+  find ${REDIS_DATA_PATH} -mindepth 1 -maxdepth 1 ! -name lost+found -exec rm -rf {} +
+fi
+TMP=${REDIS_DATA_PATH}/${REDIS_RDB_FILE}.restore
+`
+
+// 校验RDB文件头及sha256后替换dump.rdb
+const restoreVerifyScript = `
+if [ "$(head -c 5 ${TMP})" != "REDIS" ]; then
+  rm -f ${TMP}
+  result false InvalidRDB
+  exit 1
+fi
+CHECKSUM=$(sha256sum ${TMP} | cut -d ' ' -f 1)
+if [ -n "${RESTORE_CHECKSUM}" ] && [ "${CHECKSUM}" != "${RESTORE_CHECKSUM}" ]; then
+  rm -f ${TMP}
+  result false ChecksumMismatch
+  exit 1
+fi
+SIZE=$(wc -c < ${TMP} | tr -d ' ')
+mv ${TMP} ${REDIS_DATA_PATH}/${REDIS_RDB_FILE}
+printf '%s' "${RESTORE_SOURCE}" > ${MARKER}
+result true Restored "${SIZE}" "${CHECKSUM}"`
+
+const (
+	s3RestoreFetchScript = `mc alias set restore "${S3_ENDPOINT}" "${AWS_ACCESS_KEY_ID}" "${AWS_SECRET_ACCESS_KEY}" ${MC_FLAGS} > /dev/null
+mc cp ${MC_FLAGS} "restore/${S3_BUCKET}/${S3_KEY}" ${TMP}`
+	pvcRestoreFetchScript = `cp "` + restoreMountPath + `/${RESTORE_PATH}" ${TMP}`
+	urlRestoreFetchScript = `curl -fsSL -o ${TMP} "${RESTORE_URL}"`
+)
+
+// 恢复init容器写入termination-log的结果
+type restoreResult struct {
+	Restored bool   `json:"restored"`
+	Reason   string `json:"reason"`
+	Size     int64  `json:"size"`
+	Checksum string `json:"checksum"`
+}
+
+// 恢复数据所需的init容器及卷
+type restoreParameters struct {
+	Container corev1.Container
+	Volumes   []corev1.Volume
+}
+
+// 根据restoreFrom生成恢复参数，引用RedisBackup时从备份中解析存储位置和校验值
+func generateRestoreParams(cr *redisv1alpha1.Redis, cl client.Client) (*restoreParameters, error) {
+	source := cr.Spec.RestoreFrom
+	if source == nil {
+		return nil, nil
+	}
+	if cr.Spec.RedisStorage == nil {
+		return nil, fmt.Errorf("spec.restoreFrom requires spec.storage to be set")
+	}
+	container := corev1.Container{
+		Name:            restoreContainerName,
+		Image:           source.Image,
+		ImagePullPolicy: source.ImagePullPolicy,
+		Command:         []string{"/bin/sh", "-c"},
+		Env: []corev1.EnvVar{
+			{Name: "REDIS_DATA_PATH", Value: redisDataPath},
+			{Name: "REDIS_RDB_FILE", Value: redisRDBFile},
+			{Name: "RESTORE_FORCE", Value: fmt.Sprintf("%t", source.Force)},
+		},
+		VolumeMounts: []corev1.VolumeMount{
+			{Name: cr.Name, MountPath: redisDataPath},
+		},
+	}
+	params := &restoreParameters{}
+	checksum := source.Checksum
+	s3, pvc := source.S3, source.PVC
+	if source.BackupName != "" {
+		backup := &redisv1alpha1.RedisBackup{}
+		err := cl.Get(context.TODO(), types.NamespacedName{Namespace: cr.Namespace, Name: source.BackupName}, backup)
+		// 恢复完成后备份可能已按保留策略清理，沿用statefulset中已有的恢复参数
+		if meta.IsStatusConditionTrue(cr.Status.Conditions, redisv1alpha1.ConditionRestored) &&
+			(errors.IsNotFound(err) || (err == nil && backup.Status.Phase != redisv1alpha1.BackupPhaseSucceeded)) {
+			return getAppliedRestoreParams(cr), nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if backup.Status.Phase != redisv1alpha1.BackupPhaseSucceeded {
+			return nil, fmt.Errorf("redis backup %s has not succeeded", backup.Name)
+		}
+		if checksum == "" {
+			checksum = backup.Status.Checksum
+		}
+		if storage := backup.Spec.Storage.S3; storage != nil {
+			s3 = &redisv1alpha1.S3RestoreSource{
+				Endpoint:          storage.Endpoint,
+				Bucket:            storage.Bucket,
+				Key:               getBackupKey(backup),
+				Insecure:          storage.Insecure,
+				CredentialsSecret: storage.CredentialsSecret,
+			}
+		} else if storage := backup.Spec.Storage.PVC; storage != nil {
+			pvc = &redisv1alpha1.PVCRestoreSource{ClaimName: storage.ClaimName, Path: getBackupKey(backup)}
+		}
+		if container.Image == "" && backup.Spec.Image != "" {
+			container.Image = backup.Spec.Image
+		}
+	}
+	var location, fetchScript, defaultImage string
+	switch {
+	case s3 != nil:
+		location = fmt.Sprintf("s3://%s/%s", s3.Bucket, s3.Key)
+		fetchScript, defaultImage = s3RestoreFetchScript, defaultS3Image
+		mcFlags := ""
+		if s3.Insecure {
+			mcFlags = "--insecure"
+		}
+		container.Env = append(container.Env,
+			corev1.EnvVar{Name: "S3_ENDPOINT", Value: s3.Endpoint},
+			corev1.EnvVar{Name: "S3_BUCKET", Value: s3.Bucket},
+			corev1.EnvVar{Name: "S3_KEY", Value: s3.Key},
+			corev1.EnvVar{Name: "MC_FLAGS", Value: mcFlags},
+			corev1.EnvVar{Name: "MC_CONFIG_DIR", Value: "/tmp/.mc"},
+			generateSecretEnvVar("AWS_ACCESS_KEY_ID", s3.CredentialsSecret.Name),
+			generateSecretEnvVar("AWS_SECRET_ACCESS_KEY", s3.CredentialsSecret.Name),
+		)
+	case pvc != nil:
+		location = fmt.Sprintf("pvc://%s/%s", pvc.ClaimName, pvc.Path)
+		fetchScript, defaultImage = pvcRestoreFetchScript, defaultPVCImage
+		container.Env = append(container.Env, corev1.EnvVar{Name: "RESTORE_PATH", Value: pvc.Path})
+		container.VolumeMounts = append(container.VolumeMounts, corev1.VolumeMount{Name: "restore-source", MountPath: restoreMountPath, ReadOnly: true})
+		params.Volumes = append(params.Volumes, corev1.Volume{
+			Name: "restore-source",
+			VolumeSource: corev1.VolumeSource{
+				PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: pvc.ClaimName, ReadOnly: true},
+			},
+		})
+	case source.URL != "":
+		location = source.URL
+		fetchScript, defaultImage = urlRestoreFetchScript, defaultURLImage
+		container.Env = append(container.Env, corev1.EnvVar{Name: "RESTORE_URL", Value: source.URL})
+	default:
+		return nil, fmt.Errorf("one of backupName, pvc, s3 and url must be set in spec.restoreFrom")
+	}
+	if container.Image == "" {
+		container.Image = defaultImage
+	}
+	container.Env = append(container.Env,
+		corev1.EnvVar{Name: "RESTORE_SOURCE", Value: location},
+		corev1.EnvVar{Name: "RESTORE_CHECKSUM", Value: checksum},
+	)
+	container.Args = []string{restorePreludeScript + fetchScript + restoreVerifyScript}
+	params.Container = container
+	return params, nil
+}
+
+// 获取statefulset中已下发的恢复init容器及卷，避免pod模板变化触发重启
+func getAppliedRestoreParams(cr *redisv1alpha1.Redis) *restoreParameters {
+	sts, err := GetStatefulSet(cr.Namespace, cr.Name)
+	if err != nil {
+		return nil
+	}
+	var params *restoreParameters
+	for _, container := range sts.Spec.Template.Spec.InitContainers {
+		if container.Name == restoreContainerName {
+			params = &restoreParameters{Container: container}
+		}
+	}
+	if params == nil {
+		return nil
+	}
+	for _, volume := range sts.Spec.Template.Spec.Volumes {
+		if volume.Name == "restore-source" {
+			params.Volumes = append(params.Volumes, volume)
+		}
+	}
+	return params
+}
+
+// 根据恢复init容器的执行结果更新Restored状态
+func UpdateRedisRestoreCondition(cr *redisv1alpha1.Redis, cl client.Client) error {
+	if cr.Spec.RestoreFrom == nil {
+		return nil
+	}
+	logger := redisLogger(cr.Namespace, cr.Name)
+	pod, err := generateK8sClient().CoreV1().Pods(cr.Namespace).Get(context.TODO(), getRedisPodName(cr), metav1.GetOptions{})
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	var terminated *corev1.ContainerStateTerminated
+	for _, status := range pod.Status.InitContainerStatuses {
+		if status.Name != restoreContainerName {
+			continue
+		}
+		terminated = status.State.Terminated
+		if terminated == nil {
+			terminated = status.LastTerminationState.Terminated
+		}
+	}
+	if terminated == nil || terminated.Message == "" {
+		return nil
+	}
+	result := &restoreResult{}
+	if err := json.Unmarshal([]byte(terminated.Message), result); err != nil {
+		logger.Error(err, "Unable to parse redis restore result")
+		return nil
+	}
+	condition := metav1.Condition{
+		Type:               redisv1alpha1.ConditionRestored,
+		Status:             metav1.ConditionFalse,
+		Reason:             result.Reason,
+		ObservedGeneration: cr.Generation,
+	}
+	switch result.Reason {
+	case "Restored":
+		condition.Status = metav1.ConditionTrue
+		condition.Message = fmt.Sprintf("restored %d bytes, sha256 %s", result.Size, result.Checksum)
+	case "AlreadyRestored":
+		// 保留首次恢复时记录的信息
+		if meta.IsStatusConditionTrue(cr.Status.Conditions, redisv1alpha1.ConditionRestored) {
+			return nil
+		}
+		condition.Status = metav1.ConditionTrue
+		condition.Message = "data volume was already restored from this source"
+	case "VolumeNotEmpty":
+		condition.Message = "data volume is not empty, set spec.restoreFrom.force to overwrite it"
+	default:
+		condition.Message = "restore failed, see logs of init container " + restoreContainerName
+	}
+	if existing := meta.FindStatusCondition(cr.Status.Conditions, condition.Type); existing != nil &&
+		existing.Status == condition.Status && existing.Reason == condition.Reason && existing.Message == condition.Message {
+		return nil
+	}
+	meta.SetStatusCondition(&cr.Status.Conditions, condition)
+	logger.Info("Redis restore condition changed", "reason", condition.Reason)
+	return cl.Status().Update(context.TODO(), cr)
+}
@@ -26,9 +26,9 @@ func serviceLogger(namespace string, name string) logr.Logger {
 	return reqLogger
 }
 
-func CreateOrUpdateService(namespace string, serviceMeta metav1.ObjectMeta, ownerRef metav1.OwnerReference, entabledMetrics, headless bool) error {
+func CreateOrUpdateService(namespace string, serviceMeta metav1.ObjectMeta, ownerRef metav1.OwnerReference, entabledMetrics, headless bool, plaintextPort int32) error {
 	logger := serviceLogger(namespace, serviceMeta.GetName())
-	serviceDef := generateServiceDef(serviceMeta, enabledMetrics, ownerRef, headless)
+	serviceDef := generateServiceDef(serviceMeta, enabledMetrics, ownerRef, headless, plaintextPort)
 	storedService, err := getService(namespace, serviceMeta.GetName())
 	if err != nil {
 		if errors.IsNotFound(err) {
@@ -42,7 +42,7 @@ func CreateOrUpdateService(namespace string, serviceMeta metav1.ObjectMeta, owne
 	return patchService(storedService, serviceDef, namespace)
 }
 
-func generateServiceDef(serviceMeta metav1.ObjectMeta, enabledMetrics bool, ownerRef metav1.OwnerReference, headless bool) *corev1.Service {
+func generateServiceDef(serviceMeta metav1.ObjectMeta, enabledMetrics bool, ownerRef metav1.OwnerReference, headless bool, plaintextPort int32) *corev1.Service {
 	service := &corev1.Service{
 		TypeMeta:   generateMetaInformation("Service", "v1"),
 		ObjectMeta: serviceMeta,
@@ -63,11 +63,20 @@ func generateServiceDef(serviceMeta metav1.ObjectMeta, enabledMetrics bool, owne
 	if headless {
 		service.Spec.ClusterIP = "None"
 	}
+	// TLS模式下同时开放的明文端口
+	if plaintextPort != 0 {
+		service.Spec.Ports = append(service.Spec.Ports, corev1.ServicePort{
+			Name:       "redis-plaintext",
+			Port:       plaintextPort,
+			TargetPort: intstr.FromInt(int(plaintextPort)),
+			Protocol:   corev1.ProtocolTCP,
+		})
+	}
 	if enabledMetrics {
 		redisExporterService := enabledMetricsPort()
 		service.Spec.Ports = append(service.Spec.Ports, *redisExporterService)
 	}
-	AddOwnerRefToObject(&serviceMeta, ownerRef)
+	AddOwnerRefToObject(service, ownerRef)
 	return service
 }
 
@@ -115,8 +124,10 @@ func createService(namespace string, service *corev1.Service) error {
 	_, err := generateK8sClient().CoreV1().Services(namespace).Create(context.TODO(), service, metav1.CreateOptions{})
 	if err != nil {
 		logger.Error(err, "Redis service creation is failed")
+		recordOwnerEvent(service, "Service", corev1.EventTypeWarning, EventReasonCreateFailed, "%v", err)
 		return err
 	}
+	recordOwnerEvent(service, "Service", corev1.EventTypeNormal, EventReasonCreated, "created")
 	logger.Info("Redis service creation is successfully")
 	return nil
 }
@@ -144,6 +155,7 @@ func patchService(storedService *corev1.Service, newService *corev1.Service, nam
 	// 新service有变化，需要更新，并将更新内容更新到注解中
 	if !patchResult.IsEmpty() {
 		logger.Info("Changes in service Detected, Updating...", "patch", string(patchResult.Patch))
+		recordManagedUpdate("Service", storedService, newService)
 		// 更新注解
 		for k, v := range storedService.Annotations {
 			if _, present := newService.Annotations[k]; !present {
@@ -156,7 +168,11 @@ func patchService(storedService *corev1.Service, newService *corev1.Service, nam
 		}
 		logger.Info("Syncing Redis service with defined properties")
 		// 更新service
-		return updateService(namespace, newService)
+		if err := updateService(namespace, newService); err != nil {
+			return err
+		}
+		recordOwnerEvent(newService, "Service", corev1.EventTypeNormal, EventReasonUpdated, "changed %s", summarizePatch(patchResult.Patch))
+		return nil
 	}
 	logger.Info("Redis service is already in-sync")
 	return nil
@@ -167,6 +183,7 @@ func updateService(namespace string, service *corev1.Service) error {
 	_, err := generateK8sClient().CoreV1().Services(namespace).Update(context.TODO(), service, metav1.UpdateOptions{})
 	if err != nil {
 		logger.Error(err, "Redis service update failed")
+		recordOwnerEvent(service, "Service", corev1.EventTypeWarning, EventReasonUpdateFailed, "%v", err)
 		return nil
 	}
 	logger.Info("Redis service update successfully")
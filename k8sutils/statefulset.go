@@ -3,7 +3,6 @@ package k8sutils
 import (
 	"context"
 	"fmt"
-	"path"
 	"sort"
 
 	"github.com/banzaicloud/k8s-objectmatcher/patch"
@@ -13,6 +12,7 @@ import (
 	apiequality "k8s.io/apimachinery/pkg/api/equality"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 
 	redisv1alpha1 "github.com/superwongo/redis-operator/api/v1alpha1"
@@ -35,6 +35,14 @@ type statefulSetParameters struct {
 	PersistentVolumeClaim corev1.PersistentVolumeClaim
 	ImagePullSecrets      *[]corev1.LocalObjectReference
 	ExternalConfig        *string
+	Restore               *restoreParameters
+	GracePeriodSeconds    *int64
+	ConfigHash            string
+	TLSCertHash           string
+	RestartAt             string
+	NodeTuning            *nodeTuningParameters
+	InitContainers        []corev1.Container
+	Volumes               []corev1.Volume
 }
 
 type containerParameters struct {
@@ -53,12 +61,24 @@ type containerParameters struct {
 	TLSConfig                    *redisv1alpha1.TLSConfig
 	ReadinessProbe               *redisv1alpha1.Probe
 	LivenessProbe                *redisv1alpha1.Probe
+	AdditionalMounts             []corev1.VolumeMount
+	Flavor                       redisv1alpha1.RedisFlavor
+	// 非redis引擎的密码配置secret
+	AuthConfigSecret *string
+	// exporter使用实例证书提供https
+	RedisExporterTLS bool
 }
 
 func CreateOrUpdateStateful(namespace string, stsMeta metav1.ObjectMeta, params statefulSetParameters, ownerRef metav1.OwnerReference, containerParams containerParameters, sidecars *[]redisv1alpha1.Sidecar) error {
 	logger := statefulSetLogger(namespace, stsMeta.GetName())
 	// 初始化statefulset声明
 	statefulSetRef := generateStatefulSetsDef(stsMeta, params, ownerRef, containerParams, sidecars)
+	// 检查用户添加的卷、挂载及init容器是否与operator生成的冲突
+	if err := validatePodTemplate(statefulSetRef); err != nil {
+		logger.Error(err, "Invalid redis statefulset definition")
+		recordOwnerEvent(statefulSetRef, "StatefulSet", corev1.EventTypeWarning, EventReasonValidationFailed, "%v", err)
+		return err
+	}
 	// 查询已存在的statefulset
 	storedStatefulSet, err := GetStatefulSet(namespace, stsMeta.GetName())
 	if err != nil {
@@ -73,6 +93,10 @@ func CreateOrUpdateStateful(namespace string, stsMeta metav1.ObjectMeta, params
 		}
 		return err
 	}
+	// 未设置优雅停止时间时已有statefulset保持当前值，默认值只用于新建的statefulset
+	if params.GracePeriodSeconds == nil && storedStatefulSet.Spec.Template.Spec.TerminationGracePeriodSeconds != nil {
+		statefulSetRef.Spec.Template.Spec.TerminationGracePeriodSeconds = storedStatefulSet.Spec.Template.Spec.TerminationGracePeriodSeconds
+	}
 	// 存在statefulset，则更新
 	return patchStatefulSet(namespace, storedStatefulSet, statefulSetRef)
 }
@@ -119,6 +143,12 @@ func generateStatefulSetsDef(stsMeta metav1.ObjectMeta, params statefulSetParame
 	if params.Tolerations != nil {
 		statefulset.Spec.Template.Spec.Tolerations = *params.Tolerations
 	}
+	// 设置优雅停止时间，保证preStop等待数据落盘完成前不被强制停止，已有statefulset的处理见CreateOrUpdateStateful
+	gracePeriodSeconds := defaultTerminationGracePeriodSeconds
+	if params.GracePeriodSeconds != nil {
+		gracePeriodSeconds = *params.GracePeriodSeconds
+	}
+	statefulset.Spec.Template.Spec.TerminationGracePeriodSeconds = &gracePeriodSeconds
 	// 设置镜像拉取策略
 	if params.ImagePullSecrets != nil {
 		statefulset.Spec.Template.Spec.ImagePullSecrets = *params.ImagePullSecrets
@@ -141,6 +171,39 @@ func generateStatefulSetsDef(stsMeta metav1.ObjectMeta, params statefulSetParame
 				},
 			})
 	}
+	// 挂载密码配置
+	if containerParams.AuthConfigSecret != nil {
+		statefulset.Spec.Template.Spec.Volumes = append(statefulset.Spec.Template.Spec.Volumes, getAuthConfigVolume(*containerParams.AuthConfigSecret))
+	}
+	// 通过downward API暴露pod注解，preStop据此判断是否处于维护模式
+	statefulset.Spec.Template.Spec.Volumes = append(statefulset.Spec.Template.Spec.Volumes, getPodInfoVolume())
+	// 节点调优需在redis启动前完成
+	if params.NodeTuning != nil {
+		if params.NodeTuning.Container != nil {
+			statefulset.Spec.Template.Spec.InitContainers = append(statefulset.Spec.Template.Spec.InitContainers, *params.NodeTuning.Container)
+		}
+		statefulset.Spec.Template.Spec.SecurityContext = mergePodSysctls(params.SecurityContext, params.NodeTuning.Sysctls)
+	}
+	// 启动前从备份恢复数据
+	if params.Restore != nil {
+		statefulset.Spec.Template.Spec.InitContainers = append(statefulset.Spec.Template.Spec.InitContainers, params.Restore.Container)
+		statefulset.Spec.Template.Spec.Volumes = append(statefulset.Spec.Template.Spec.Volumes, params.Restore.Volumes...)
+	}
+	// 添加用户自定义的init容器及卷
+	statefulset.Spec.Template.Spec.InitContainers = append(statefulset.Spec.Template.Spec.InitContainers, params.InitContainers...)
+	statefulset.Spec.Template.Spec.Volumes = append(statefulset.Spec.Template.Spec.Volumes, params.Volumes...)
+	// 配置变化时触发滚动重启
+	if params.ConfigHash != "" {
+		statefulset.Spec.Template.Annotations[redisConfigHashAnnotation] = params.ConfigHash
+	}
+	// 证书更新时触发滚动重启
+	if params.TLSCertHash != "" {
+		statefulset.Spec.Template.Annotations[tlsCertHashAnnotation] = params.TLSCertHash
+	}
+	// 到达重启时间时触发重启
+	if params.RestartAt != "" {
+		statefulset.Spec.Template.Annotations[RedisRestartAtAnnotation] = params.RestartAt
+	}
 	// 添加拥有者引用
 	AddOwnerRefToObject(statefulset, ownerRef)
 	return statefulset
@@ -162,14 +225,227 @@ func generateContainerDef(name string, containerParams containerParameters, enab
 				containerParams.PersistenceEnabled,
 				containerParams.RedisExporterEnvs,
 				containerParams.TLSConfig,
+				containerParams.Flavor,
 			),
+			Args:         getFlavorArgs(containerParams.Flavor, containerParams.AuthConfigSecret, containerParams.PersistenceEnabled, containerParams.TLSConfig),
+			VolumeMounts: append(append(getVolumeMount(name, containerParams.PersistenceEnabled, externalConfig, containerParams.TLSConfig), getPodInfoVolumeMount()), containerParams.AdditionalMounts...),
+			Lifecycle:    getLifecycle(),
 		},
 	}
+	if containerParams.AuthConfigSecret != nil {
+		containerDefinition[0].VolumeMounts = append(containerDefinition[0].VolumeMounts, getAuthConfigVolumeMount())
+	}
+	containerDefinition[0].ReadinessProbe = getProbeInfo(containerParams.ReadinessProbe, containerParams.Flavor)
+	containerDefinition[0].LivenessProbe = getProbeInfo(containerParams.LivenessProbe, containerParams.Flavor)
+	if enabledMetrics && containerParams.RedisExporterImage != "" {
+		containerDefinition = append(containerDefinition, generateRedisExporterContainer(containerParams))
+	}
 	return containerDefinition
 }
 
+// 初始化redis exporter容器，端口名称与service的redis-exporter端口一致，供PodMonitor使用
+func generateRedisExporterContainer(containerParams containerParameters) corev1.Container {
+	container := corev1.Container{
+		Name:            "redis-exporter",
+		Image:           containerParams.RedisExporterImage,
+		ImagePullPolicy: containerParams.RedisExporterImagePullPolicy,
+		Env: getEnvironmentVariables(
+			containerParams.Role,
+			true,
+			containerParams.EnabledPassword,
+			containerParams.SecretName,
+			containerParams.SecretKey,
+			containerParams.PersistenceEnabled,
+			containerParams.RedisExporterEnvs,
+			containerParams.TLSConfig,
+			containerParams.Flavor,
+		),
+		Ports: []corev1.ContainerPort{
+			{
+				Name:          "redis-exporter",
+				ContainerPort: redisExporterPort,
+				Protocol:      corev1.ProtocolTCP,
+			},
+		},
+	}
+	if containerParams.RedisExporterResources != nil {
+		container.Resources = *containerParams.RedisExporterResources
+	}
+	// exporter读取REDIS_PASSWORD
+	if containerParams.EnabledPassword != nil && *containerParams.EnabledPassword {
+		container.Env = append(container.Env, corev1.EnvVar{
+			Name: "REDIS_PASSWORD",
+			ValueFrom: &corev1.EnvVarSource{
+				SecretKeyRef: &corev1.SecretKeySelector{
+					LocalObjectReference: corev1.LocalObjectReference{Name: *containerParams.SecretName},
+					Key:                  *containerParams.SecretKey,
+				},
+			},
+		})
+	}
+	if containerParams.TLSConfig != nil {
+		container.VolumeMounts = getVolumeMount("", nil, nil, containerParams.TLSConfig)
+		if containerParams.RedisExporterTLS {
+			_, tlsCert, tlsCertKey := getTLSFilePaths(containerParams.TLSConfig)
+			container.Env = append(container.Env,
+				corev1.EnvVar{Name: "REDIS_EXPORTER_TLS_SERVER_CERT_FILE", Value: tlsCert},
+				corev1.EnvVar{Name: "REDIS_EXPORTER_TLS_SERVER_KEY_FILE", Value: tlsCertKey},
+			)
+		}
+	}
+	return container
+}
+
+// 探针通过TLS端口执行PING，需要客户端证书时使用服务端证书认证
+const probeScript = `CLI="${REDIS_CLI:-redis-cli} -p 6379 --no-auth-warning"
+[ -n "${REDIS_PASSOWD}" ] && CLI="${CLI} -a ${REDIS_PASSOWD}"
+[ "${TLS_MODE}" = "true" ] && CLI="${CLI} --tls --cacert ${REDIS_TLS_CA_KEY} --cert ${REDIS_TLS_CERT} --key ${REDIS_TLS_CERT_KEY}"
+${CLI} PING | grep -q PONG`
+
+// 初始化redis容器探针，dragonfly镜像不包含命令行客户端，使用TCP探测
+func getProbeInfo(probe *redisv1alpha1.Probe, flavor redisv1alpha1.RedisFlavor) *corev1.Probe {
+	if probe == nil {
+		return nil
+	}
+	probeDef := &corev1.Probe{
+		InitialDelaySeconds: probe.InitialDelaySeconds,
+		TimeoutSeconds:      probe.TimeoutSeconds,
+		PeriodSeconds:       probe.PeriodSeconds,
+		SuccessThreshold:    probe.SuccessThreshold,
+		FailureThreshold:    probe.FailureThreshold,
+	}
+	if flavor == redisv1alpha1.RedisFlavorDragonfly {
+		probeDef.TCPSocket = &corev1.TCPSocketAction{Port: intstr.FromInt(redisPort)}
+	} else {
+		probeDef.Exec = &corev1.ExecAction{Command: []string{"/bin/sh", "-c", probeScript}}
+	}
+	return probeDef
+}
+
+// 默认优雅停止时间，kubernetes默认的30秒不足以完成FAILOVER及BGSAVE
+const defaultTerminationGracePeriodSeconds = int64(300)
+
+// downward API挂载目录，annotations文件随pod注解更新
+const podInfoPath = "/etc/podinfo"
+
+// 停止前的处理：有从节点的主节点先执行FAILOVER（维护模式下跳过），开启持久化时等待AOF刷盘或完成BGSAVE
+const preStopScript = `[ -n "$(command -v ${REDIS_CLI:=redis-cli})" ] || exit 0
+CLI="${REDIS_CLI} -p 6379 --no-auth-warning"
+[ -n "${REDIS_PASSOWD}" ] && CLI="${CLI} -a ${REDIS_PASSOWD}"
+[ "${TLS_MODE}" = "true" ] && CLI="${CLI} --tls --cacert ${REDIS_TLS_CA_KEY} --cert ${REDIS_TLS_CERT} --key ${REDIS_TLS_CERT_KEY}"
+info() { ${CLI} INFO "$1" | tr -d '\r' | grep "^$2:" | cut -d ':' -f 2; }
+if grep -qx '` + RedisMaintenanceAnnotation + `="true"' ` + podInfoPath + `/annotations 2>/dev/null; then
+  echo "maintenance mode is set, skipping FAILOVER"
+elif [ "$(info replication role)" = "master" ] && [ "$(info replication connected_slaves)" -gt 0 ]; then
+  ${CLI} FAILOVER TIMEOUT 10000 || true
+  while [ "$(info replication role)" = "master" ] && [ "$(info replication master_failover_state)" != "no-failover" ]; do sleep 1; done
+fi
+[ "${PERSISTENCE_ENABLED}" = "true" ] || exit 0
+if [ "$(${CLI} CONFIG GET appendonly | tail -n 1)" = "yes" ]; then
+  while [ "$(info persistence aof_rewrite_in_progress)" != "0" ] || [ "$(info persistence aof_pending_bio_fsync)" != "0" ]; do sleep 1; done
+else
+  LAST=$(${CLI} LASTSAVE)
+  ${CLI} BGSAVE SCHEDULE
+  while [ "$(${CLI} LASTSAVE)" = "${LAST}" ] && [ "$(info persistence rdb_last_bgsave_status)" = "ok" ]; do sleep 1; done
+fi`
+
+// 以downward API挂载pod注解
+func getPodInfoVolume() corev1.Volume {
+	return corev1.Volume{
+		Name: "pod-info",
+		VolumeSource: corev1.VolumeSource{
+			DownwardAPI: &corev1.DownwardAPIVolumeSource{
+				Items: []corev1.DownwardAPIVolumeFile{
+					{Path: "annotations", FieldRef: &corev1.ObjectFieldSelector{FieldPath: "metadata.annotations"}},
+				},
+			},
+		},
+	}
+}
+
+func getPodInfoVolumeMount() corev1.VolumeMount {
+	return corev1.VolumeMount{
+		Name:      "pod-info",
+		ReadOnly:  true,
+		MountPath: podInfoPath,
+	}
+}
+
+// 初始化redis容器生命周期钩子
+func getLifecycle() *corev1.Lifecycle {
+	return &corev1.Lifecycle{
+		PreStop: &corev1.LifecycleHandler{
+			Exec: &corev1.ExecAction{
+				Command: []string{"/bin/sh", "-c", preStopScript},
+			},
+		},
+	}
+}
+
+// 校验pod模板中卷名、容器名及各容器（含init容器）挂载路径是否重复
+func validatePodTemplate(sts *appsv1.StatefulSet) error {
+	podSpec := sts.Spec.Template.Spec
+	allContainers := append(append([]corev1.Container{}, podSpec.InitContainers...), podSpec.Containers...)
+	volumes := map[string]bool{}
+	for _, pvc := range sts.Spec.VolumeClaimTemplates {
+		volumes[pvc.Name] = true
+	}
+	for _, volume := range podSpec.Volumes {
+		if volumes[volume.Name] {
+			return fmt.Errorf("volume %s conflicts with a volume managed by the operator", volume.Name)
+		}
+		volumes[volume.Name] = true
+	}
+	containers := map[string]bool{}
+	for _, container := range allContainers {
+		if containers[container.Name] {
+			return fmt.Errorf("container name %s is already in use", container.Name)
+		}
+		containers[container.Name] = true
+	}
+	for _, container := range allContainers {
+		mountPaths := map[string]bool{}
+		for _, mount := range container.VolumeMounts {
+			if !volumes[mount.Name] {
+				return fmt.Errorf("volume mount %s of container %s does not refer to any volume", mount.Name, container.Name)
+			}
+			if mountPaths[mount.MountPath] {
+				return fmt.Errorf("mount path %s of container %s conflicts with a mount managed by the operator", mount.MountPath, container.Name)
+			}
+			mountPaths[mount.MountPath] = true
+		}
+	}
+	return nil
+}
+
+// 初始化redis容器挂载卷
+func getVolumeMount(name string, persistenceEnabled *bool, externalConfig *string, tlsConfig *redisv1alpha1.TLSConfig) []corev1.VolumeMount {
+	var volumeMounts []corev1.VolumeMount
+	// 挂载数据卷，RDB及AOF文件均保存在该目录
+	if persistenceEnabled != nil && *persistenceEnabled {
+		volumeMounts = append(volumeMounts, corev1.VolumeMount{
+			Name:      name,
+			MountPath: redisDataPath,
+		})
+	}
+	if tlsConfig != nil {
+		volumeMounts = append(volumeMounts, corev1.VolumeMount{
+			Name:      "tls-certs",
+			ReadOnly:  true,
+			MountPath: tlsMountPath,
+		})
+	}
+	if externalConfig != nil {
+		volumeMounts = append(volumeMounts, corev1.VolumeMount{
+			Name:      "external-config",
+			MountPath: "/etc/redis/external.conf.d",
+		})
+	}
+	return volumeMounts
+}
+
 // 获取环境变量
-func getEnvironmentVariables(role string, enabledMetrics bool, enabledPassword *bool, secretName *string, secretKey *string, persistenceEnabled *bool, extraEnvs *[]corev1.EnvVar, tlsConfig *redisv1alpha1.TLSConfig) []corev1.EnvVar {
+func getEnvironmentVariables(role string, enabledMetrics bool, enabledPassword *bool, secretName *string, secretKey *string, persistenceEnabled *bool, extraEnvs *[]corev1.EnvVar, tlsConfig *redisv1alpha1.TLSConfig, flavor redisv1alpha1.RedisFlavor) []corev1.EnvVar {
 	envVars := []corev1.EnvVar{
 		{Name: "SERVER_MODE", Value: role},
 		{Name: "SETUP_MODE", Value: role},
@@ -179,17 +455,18 @@ func getEnvironmentVariables(role string, enabledMetrics bool, enabledPassword *
 		redisHost = "rediss://localhost:6379"
 		envVars = append(envVars, GenerateTLSEnvironmentVariables(tlsConfig)...)
 		if enabledMetrics {
+			caCert, tlsCert, tlsCertKey := getTLSFilePaths(tlsConfig)
 			envVars = append(envVars, corev1.EnvVar{
 				Name:  "REDIS_EXPORTER_TLS_CLIENT_KEY_FILE",
-				Value: "/tls/tls.key",
+				Value: tlsCertKey,
 			})
 			envVars = append(envVars, corev1.EnvVar{
 				Name:  "REDIS_EXPORTER_TLS_CLIENT_CERT_FILE",
-				Value: "/tls/tls.crt",
+				Value: tlsCert,
 			})
 			envVars = append(envVars, corev1.EnvVar{
 				Name:  "REDIS_EXPORTER_TLS_CA_CERT_FILE",
-				Value: "/tls/ca.crt",
+				Value: caCert,
 			})
 			envVars = append(envVars, corev1.EnvVar{
 				Name:  "REDIS_EXPORTER_SKIP_TLS_VERIFICATION",
@@ -220,6 +497,13 @@ func getEnvironmentVariables(role string, enabledMetrics bool, enabledPassword *
 			Value: "true",
 		})
 	}
+	// 非redis引擎使用各自的命令行客户端
+	if flavor != "" && flavor != redisv1alpha1.RedisFlavorRedis {
+		envVars = append(envVars, corev1.EnvVar{
+			Name:  "REDIS_CLI",
+			Value: flavors[flavor].CLI,
+		})
+	}
 	if extraEnvs != nil {
 		envVars = append(envVars, *extraEnvs...)
 	}
@@ -232,36 +516,22 @@ func getEnvironmentVariables(role string, enabledMetrics bool, enabledPassword *
 // 初始化TLS环境变量
 func GenerateTLSEnvironmentVariables(tlsConfig *redisv1alpha1.TLSConfig) []corev1.EnvVar {
 	var envVars []corev1.EnvVar
-	root := "/tls/"
-
-	// 设置默认值
-	caCert := "ca.crt"
-	tlsCert := "tls.crt"
-	tlsCertKey := "tls.key"
-	if tlsConfig.CaKeyFile != "" {
-		caCert = tlsConfig.CaKeyFile
-	}
-	if tlsConfig.CertKeyFile != "" {
-		tlsCert = tlsConfig.CertKeyFile
-	}
-	if tlsConfig.KeyFile != "" {
-		tlsCertKey = tlsConfig.KeyFile
-	}
+	caCert, tlsCert, tlsCertKey := getTLSFilePaths(tlsConfig)
 	envVars = append(envVars, corev1.EnvVar{
 		Name:  "TLS_MODE",
 		Value: "true",
 	})
 	envVars = append(envVars, corev1.EnvVar{
 		Name:  "REDIS_TLS_CA_KEY",
-		Value: path.Join(root, caCert),
+		Value: caCert,
 	})
 	envVars = append(envVars, corev1.EnvVar{
 		Name:  "REDIS_TLS_CERT",
-		Value: path.Join(root, tlsCert),
+		Value: tlsCert,
 	})
 	envVars = append(envVars, corev1.EnvVar{
 		Name:  "REDIS_TLS_CERT_KEY",
-		Value: path.Join(root, tlsCertKey),
+		Value: tlsCertKey,
 	})
 	return envVars
 }
@@ -307,8 +577,10 @@ func createStatefulSet(namespace string, sts *appsv1.StatefulSet) error {
 	_, err := generateK8sClient().AppsV1().StatefulSets(namespace).Create(context.TODO(), sts, metav1.CreateOptions{})
 	if err != nil {
 		logger.Error(err, "Redis statefulSet creation failed")
+		recordOwnerEvent(sts, "StatefulSet", corev1.EventTypeWarning, EventReasonCreateFailed, "%v", err)
 		return err
 	}
+	recordOwnerEvent(sts, "StatefulSet", corev1.EventTypeNormal, EventReasonCreated, "created")
 	return nil
 }
 
@@ -317,6 +589,7 @@ func updatStatefulSet(namespace string, sts *appsv1.StatefulSet) error {
 	_, err := generateK8sClient().AppsV1().StatefulSets(namespace).Update(context.TODO(), sts, metav1.UpdateOptions{})
 	if err != nil {
 		logger.Error(err, "Redis statefulSet update failed")
+		recordOwnerEvent(sts, "StatefulSet", corev1.EventTypeWarning, EventReasonUpdateFailed, "%v", err)
 		return err
 	}
 	logger.Info("Redis statefulSet successfully updated")
@@ -343,10 +616,13 @@ func patchStatefulSet(namespace string, storedStatefulSet *appsv1.StatefulSet, n
 	}
 	if !patchResult.IsEmpty() {
 		logger.Info("Changes in statefulSet Detected, Updating...", "patch", string(patchResult.Patch))
+		recordManagedUpdate("StatefulSet", storedStatefulSet, newStatefulSet)
 		if !apiequality.Semantic.DeepEqual(newStatefulSet.Spec.VolumeClaimTemplates, storedStatefulSet.Spec.VolumeClaimTemplates) {
 			logger.Error(fmt.Errorf("ignored change in cr.spec.storage.volumeClaimTemplate because it is not supported by statefulSet"),
 				"Redis statefulSet is patched partially")
 			newStatefulSet.Spec.VolumeClaimTemplates = storedStatefulSet.Spec.VolumeClaimTemplates
+			recordOwnerEvent(newStatefulSet, "StatefulSet", corev1.EventTypeWarning, EventReasonUpdateIgnored,
+				"change in spec.storage.volumeClaimTemplate is ignored because it is not supported by statefulSet")
 		}
 		// 补全新statefulset的注解信息
 		for k, v := range storedStatefulSet.Annotations {
@@ -358,7 +634,11 @@ func patchStatefulSet(namespace string, storedStatefulSet *appsv1.StatefulSet, n
 			logger.Error(err, "Unable to patch redis statefulSet with comparison object")
 			return err
 		}
-		return updatStatefulSet(namespace, newStatefulSet)
+		if err := updatStatefulSet(namespace, newStatefulSet); err != nil {
+			return err
+		}
+		recordOwnerEvent(newStatefulSet, "StatefulSet", corev1.EventTypeNormal, EventReasonUpdated, "changed %s", summarizePatch(patchResult.Patch))
+		return nil
 	}
 	logger.Info("Reconciliation Complete, no Changes required.")
 	return nil
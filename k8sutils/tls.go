@@ -0,0 +1,404 @@
+package k8sutils
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	redisv1alpha1 "github.com/superwongo/redis-operator/api/v1alpha1"
+)
+
+const (
+	operatorCASecretName = "redis-operator-ca"
+	caCertKey            = "ca.crt"
+	caPrivateKey         = "ca.key"
+	tlsCertKey           = "tls.crt"
+	tlsPrivateKey        = "tls.key"
+	caValidity           = 10 * 365 * 24 * time.Hour
+	defaultCertDuration  = 90 * 24 * time.Hour
+	defaultCertRenewal   = 30 * 24 * time.Hour
+	// pod模板中记录证书摘要，证书更新时滚动重启以重新加载
+	tlsCertHashAnnotation = "redis.superwongo.com/tls-cert-hash"
+	serviceAccountNSFile  = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+	// 证书secret在容器内的挂载目录
+	tlsMountPath = "/tls"
+)
+
+func tlsLogger(namespace string, name string) logr.Logger {
+	reqLogger := log.Log.WithValues("Request.TLS.Namespace", namespace, "Request.TLS.Name", name)
+	return reqLogger
+}
+
+// 获取operator所在namespace
+func getOperatorNamespace() string {
+	if namespace := os.Getenv("OPERATOR_NAMESPACE"); namespace != "" {
+		return namespace
+	}
+	if data, err := os.ReadFile(serviceAccountNSFile); err == nil {
+		return strings.TrimSpace(string(data))
+	}
+	return "default"
+}
+
+// 自动签发证书的secret名称
+func getAutoTLSSecretName(cr *redisv1alpha1.Redis) string {
+	return cr.Name + "-tls"
+}
+
+// 是否启用operator自动签发证书
+func isAutoTLSEnabled(cr *redisv1alpha1.Redis) bool {
+	return cr.Spec.AutoTLS != nil && cr.Spec.AutoTLS.Enabled
+}
+
+// 获取生效的TLS配置，autoTLS及cert-manager未指定secret时指向<name>-tls
+func getRedisTLSSpec(cr *redisv1alpha1.Redis) *redisv1alpha1.TLSConfig {
+	if isAutoTLSEnabled(cr) {
+		return &redisv1alpha1.TLSConfig{
+			Secret:     corev1.SecretVolumeSource{SecretName: getAutoTLSSecretName(cr)},
+			TLSOptions: cr.Spec.AutoTLS.TLSOptions,
+		}
+	}
+	if cr.Spec.TLS != nil && cr.Spec.TLS.IssuerRef != nil && cr.Spec.TLS.Secret.SecretName == "" {
+		tlsSpec := cr.Spec.TLS.DeepCopy()
+		tlsSpec.Secret.SecretName = getAutoTLSSecretName(cr)
+		return tlsSpec
+	}
+	return cr.Spec.TLS
+}
+
+// 获取容器内CA证书、服务端证书及私钥路径
+func getTLSFilePaths(tlsConfig *redisv1alpha1.TLSConfig) (string, string, string) {
+	caCert, tlsCert, tlsKey := caCertKey, tlsCertKey, tlsPrivateKey
+	if tlsConfig.CaKeyFile != "" {
+		caCert = tlsConfig.CaKeyFile
+	}
+	if tlsConfig.CertKeyFile != "" {
+		tlsCert = tlsConfig.CertKeyFile
+	}
+	if tlsConfig.KeyFile != "" {
+		tlsKey = tlsConfig.KeyFile
+	}
+	return path.Join(tlsMountPath, caCert), path.Join(tlsMountPath, tlsCert), path.Join(tlsMountPath, tlsKey)
+}
+
+// 获取明文端口，0表示禁用
+func getPlaintextPort(tlsConfig *redisv1alpha1.TLSConfig) int32 {
+	if tlsConfig == nil || tlsConfig.PlaintextPort == nil {
+		return 0
+	}
+	return *tlsConfig.PlaintextPort
+}
+
+// 校验TLS选项
+func validateRedisTLS(cr *redisv1alpha1.Redis) error {
+	tlsSpec := getRedisTLSSpec(cr)
+	if tlsSpec == nil {
+		return nil
+	}
+	plaintextPort := getPlaintextPort(tlsSpec)
+	if plaintextPort == redisPort || plaintextPort == redisExporterPort {
+		return fmt.Errorf("spec.TLS.plaintextPort %d conflicts with the TLS or exporter port", plaintextPort)
+	}
+	for _, protocol := range tlsSpec.Protocols {
+		if protocol != "TLSv1.2" && protocol != "TLSv1.3" {
+			return fmt.Errorf("unsupported TLS protocol %q, expected TLSv1.2 or TLSv1.3", protocol)
+		}
+	}
+	if plaintextPort == 0 {
+		if tlsSpec.Replication != nil && !*tlsSpec.Replication {
+			return fmt.Errorf("TLS replication can only be disabled when a plaintext port is open")
+		}
+		if tlsSpec.Cluster != nil && !*tlsSpec.Cluster {
+			return fmt.Errorf("TLS cluster bus can only be disabled when a plaintext port is open")
+		}
+	}
+	if getRedisFlavor(cr) == redisv1alpha1.RedisFlavorDragonfly &&
+		(plaintextPort != 0 || tlsSpec.AuthClients != "" || len(tlsSpec.Protocols) > 0 || tlsSpec.Ciphers != "" || tlsSpec.Ciphersuites != "") {
+		return fmt.Errorf("TLS plaintextPort, authClients, protocols and ciphers are not supported by flavor dragonfly")
+	}
+	return nil
+}
+
+// 生成TLS相关的redis.conf配置，certUsers为true时将客户端证书CN映射为ACL用户
+func generateTLSConfig(cr *redisv1alpha1.Redis, certUsers bool) []string {
+	tlsSpec := getRedisTLSSpec(cr)
+	if tlsSpec == nil {
+		return nil
+	}
+	caFile, certFile, keyFile := getTLSFilePaths(tlsSpec)
+	lines := []string{
+		fmt.Sprintf("port %d", getPlaintextPort(tlsSpec)),
+		fmt.Sprintf("tls-port %d", redisPort),
+		"tls-cert-file " + certFile,
+		"tls-key-file " + keyFile,
+		"tls-ca-cert-file " + caFile,
+		"tls-replication " + yesOrNo(tlsSpec.Replication == nil || *tlsSpec.Replication),
+		"tls-cluster " + yesOrNo(tlsSpec.Cluster == nil || *tlsSpec.Cluster),
+	}
+	// 未设置时不覆盖镜像配置，避免升级后拒绝没有客户端证书的已有客户端
+	if tlsSpec.AuthClients != "" {
+		lines = append(lines, "tls-auth-clients "+tlsSpec.AuthClients)
+	}
+	if certUsers {
+		lines = append(lines, "tls-auth-clients-user CN")
+	}
+	if len(tlsSpec.Protocols) > 0 {
+		lines = append(lines, fmt.Sprintf("tls-protocols %q", strings.Join(tlsSpec.Protocols, " ")))
+	}
+	if tlsSpec.Ciphers != "" {
+		lines = append(lines, "tls-ciphers "+tlsSpec.Ciphers)
+	}
+	if tlsSpec.Ciphersuites != "" {
+		lines = append(lines, "tls-ciphersuites "+tlsSpec.Ciphersuites)
+	}
+	return lines
+}
+
+// 签发或续签证书，返回证书摘要用于触发滚动重启
+func ReconcileRedisTLS(cr *redisv1alpha1.Redis) (string, error) {
+	if cr.Spec.TLS != nil && cr.Spec.TLS.IssuerRef != nil {
+		return ReconcileRedisCertificate(cr)
+	}
+	return ReconcileRedisAutoTLS(cr)
+}
+
+// 证书需要包含的service、headless service及pod域名
+func getRedisTLSDNSNames(cr *redisv1alpha1.Redis) []string {
+	var names []string
+	for _, svc := range []string{cr.Name, cr.Name + "-headless"} {
+		names = append(names, svc, svc+"."+cr.Namespace, svc+"."+cr.Namespace+".svc", svc+"."+cr.Namespace+".svc.cluster.local")
+	}
+	headless := cr.Name + "-headless." + cr.Namespace + ".svc"
+	names = append(names, "*."+headless, "*."+headless+".cluster.local", getRedisPodDNSName(cr, getRedisPodName(cr)), "localhost")
+	sort.Strings(names)
+	return names
+}
+
+func encodePrivateKey(key *ecdsa.PrivateKey) ([]byte, error) {
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), nil
+}
+
+func parseCertificate(data []byte) (*x509.Certificate, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data found")
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
+
+func newSerialNumber() (*big.Int, error) {
+	return rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+}
+
+// 查询或创建operator的自签名CA
+func getOrCreateOperatorCA() (*x509.Certificate, crypto.Signer, []byte, error) {
+	namespace := getOperatorNamespace()
+	logger := tlsLogger(namespace, operatorCASecretName)
+	secrets := generateK8sClient().CoreV1().Secrets(namespace)
+	secret, err := secrets.Get(context.TODO(), operatorCASecretName, metav1.GetOptions{})
+	if err == nil {
+		cert, err := parseCertificate(secret.Data[caCertKey])
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		block, _ := pem.Decode(secret.Data[caPrivateKey])
+		if block == nil {
+			return nil, nil, nil, fmt.Errorf("no CA private key found in secret %s", operatorCASecretName)
+		}
+		key, err := x509.ParseECPrivateKey(block.Bytes)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		return cert, key, secret.Data[caCertKey], nil
+	}
+	if !errors.IsNotFound(err) {
+		return nil, nil, nil, err
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	serial, err := newSerialNumber()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "redis-operator-ca"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(caValidity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	keyPEM, err := encodePrivateKey(key)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	secret = &corev1.Secret{
+		TypeMeta:   generateMetaInformation("Secret", "v1"),
+		ObjectMeta: metav1.ObjectMeta{Name: operatorCASecretName, Namespace: namespace},
+		Data:       map[string][]byte{caCertKey: certPEM, caPrivateKey: keyPEM},
+	}
+	if _, err := secrets.Create(context.TODO(), secret, metav1.CreateOptions{}); err != nil {
+		// 多个协调并发创建时以先创建的为准
+		if errors.IsAlreadyExists(err) {
+			return getOrCreateOperatorCA()
+		}
+		logger.Error(err, "Redis operator CA creation failed")
+		return nil, nil, nil, err
+	}
+	logger.Info("Redis operator CA creation was successful")
+	cert, err := x509.ParseCertificate(der)
+	return cert, key, certPEM, err
+}
+
+// 签发证书，返回PEM格式的证书及私钥
+func issueCertificate(ca *x509.Certificate, caKey crypto.Signer, commonName string, dnsNames []string, ips []net.IP, usages []x509.ExtKeyUsage, duration time.Duration) ([]byte, []byte, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	serial, err := newSerialNumber()
+	if err != nil {
+		return nil, nil, err
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: commonName},
+		DNSNames:     dnsNames,
+		IPAddresses:  ips,
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(duration),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:  usages,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca, &key.PublicKey, caKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyPEM, err := encodePrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), keyPEM, nil
+}
+
+// 判断已有证书是否需要重新签发：CA变化、域名变化或即将过期
+func certificateNeedsRenewal(secret *corev1.Secret, caPEM []byte, dnsNames []string, renewBefore time.Duration) bool {
+	if !bytes.Equal(secret.Data[caCertKey], caPEM) {
+		return true
+	}
+	cert, err := parseCertificate(secret.Data[tlsCertKey])
+	if err != nil {
+		return true
+	}
+	existing := append([]string{}, cert.DNSNames...)
+	sort.Strings(existing)
+	if strings.Join(existing, ",") != strings.Join(dnsNames, ",") {
+		return true
+	}
+	return time.Until(cert.NotAfter) < renewBefore
+}
+
+// 计算证书摘要
+func getCertificateHash(secret *corev1.Secret) string {
+	return fmt.Sprintf("%x", sha256.Sum256(secret.Data[tlsCertKey]))[:16]
+}
+
+// 签发或续签redis服务端证书，返回证书摘要
+func ReconcileRedisAutoTLS(cr *redisv1alpha1.Redis) (string, error) {
+	if !isAutoTLSEnabled(cr) {
+		return "", nil
+	}
+	name := getAutoTLSSecretName(cr)
+	logger := tlsLogger(cr.Namespace, name)
+	if cr.Spec.TLS != nil {
+		return "", fmt.Errorf("spec.TLS and spec.autoTLS cannot be set at the same time")
+	}
+	duration, renewBefore := defaultCertDuration, defaultCertRenewal
+	if cr.Spec.AutoTLS.Duration != nil {
+		duration = cr.Spec.AutoTLS.Duration.Duration
+	}
+	if cr.Spec.AutoTLS.RenewBefore != nil {
+		renewBefore = cr.Spec.AutoTLS.RenewBefore.Duration
+	}
+	if renewBefore >= duration {
+		return "", fmt.Errorf("spec.autoTLS.renewBefore must be shorter than spec.autoTLS.duration")
+	}
+	ca, caKey, caPEM, err := getOrCreateOperatorCA()
+	if err != nil {
+		return "", err
+	}
+	dnsNames := getRedisTLSDNSNames(cr)
+	secrets := generateK8sClient().CoreV1().Secrets(cr.Namespace)
+	stored, err := secrets.Get(context.TODO(), name, metav1.GetOptions{})
+	if err != nil && !errors.IsNotFound(err) {
+		return "", err
+	}
+	found := err == nil
+	if found && !certificateNeedsRenewal(stored, caPEM, dnsNames, renewBefore) {
+		return getCertificateHash(stored), nil
+	}
+	certPEM, keyPEM, err := issueCertificate(ca, caKey, cr.Name, dnsNames, []net.IP{net.ParseIP("127.0.0.1")},
+		[]x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth}, duration)
+	if err != nil {
+		logger.Error(err, "Unable to issue redis certificate")
+		return "", err
+	}
+	labels := getRedisLabels(cr.ObjectMeta.Name, "standalone", "standalone", cr.ObjectMeta.Labels)
+	secret := &corev1.Secret{
+		TypeMeta:   generateMetaInformation("Secret", "v1"),
+		ObjectMeta: generateObjectMetaInformation(name, cr.Namespace, labels, generateObjectAnots(cr.ObjectMeta)),
+		Type:       corev1.SecretTypeTLS,
+		Data:       map[string][]byte{caCertKey: caPEM, tlsCertKey: certPEM, tlsPrivateKey: keyPEM},
+	}
+	AddOwnerRefToObject(secret, redisAsOwner(cr))
+	if !found {
+		if _, err := secrets.Create(context.TODO(), secret, metav1.CreateOptions{}); err != nil {
+			logger.Error(err, "Redis TLS secret creation failed")
+			return "", err
+		}
+		logger.Info("Redis TLS certificate issued")
+	} else {
+		secret.ResourceVersion = stored.ResourceVersion
+		if _, err := secrets.Update(context.TODO(), secret, metav1.UpdateOptions{}); err != nil {
+			logger.Error(err, "Redis TLS secret update failed")
+			return "", err
+		}
+		logger.Info("Redis TLS certificate renewed")
+	}
+	return getCertificateHash(secret), nil
+}
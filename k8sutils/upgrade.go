@@ -0,0 +1,358 @@
+package k8sutils
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	redisv1alpha1 "github.com/superwongo/redis-operator/api/v1alpha1"
+)
+
+// 镜像tag中的版本号，如7.2.4-alpine、v8.0.1、x86_64_v6.3.4
+var imageVersionPattern = regexp.MustCompile(`^(?:[a-z0-9]+_)*v?(\d+)\.(\d+)(?:\.(\d+))?`)
+
+// 各版本写入的RDB格式版本，低版本无法加载高版本生成的RDB文件
+var rdbVersions = map[redisv1alpha1.RedisFlavor]map[string]int{
+	redisv1alpha1.RedisFlavorRedis: {
+		"3.2": 8, "4.0": 9, "5.0": 9, "6.0": 9, "6.2": 9,
+		"7.0": 10, "7.2": 11, "7.4": 12,
+	},
+	redisv1alpha1.RedisFlavorValkey: {
+		"7.2": 11, "8.0": 11, "8.1": 11,
+	},
+}
+
+// 从镜像tag中解析版本号，digest或latest等无法解析时返回false
+func parseImageVersion(image string) ([3]int, bool) {
+	version, _, ok := parseImageVersionParts(image)
+	return version, ok
+}
+
+// 从镜像tag中解析版本号及tag给出的位数，如7.2为2位
+func parseImageVersionParts(image string) ([3]int, int, bool) {
+	if strings.Contains(image, "@") {
+		return [3]int{}, 0, false
+	}
+	tag := image[strings.LastIndex(image, "/")+1:]
+	index := strings.LastIndex(tag, ":")
+	if index < 0 {
+		return [3]int{}, 0, false
+	}
+	return parseVersionParts(tag[index+1:])
+}
+
+func parseVersion(value string) ([3]int, bool) {
+	version, _, ok := parseVersionParts(value)
+	return version, ok
+}
+
+// 解析版本号，未给出的补丁版本按0处理，同时返回给出的位数
+func parseVersionParts(value string) ([3]int, int, bool) {
+	version := [3]int{}
+	match := imageVersionPattern.FindStringSubmatch(value)
+	if match == nil {
+		return version, 0, false
+	}
+	for i := range version {
+		version[i], _ = strconv.Atoi(match[i+1])
+	}
+	if match[3] == "" {
+		return version, 2, true
+	}
+	return version, 3, true
+}
+
+func formatVersion(version [3]int) string {
+	return formatVersionParts(version, 3)
+}
+
+func formatVersionParts(version [3]int, parts int) string {
+	values := make([]string, parts)
+	for i := range values {
+		values[i] = strconv.Itoa(version[i])
+	}
+	return strings.Join(values, ".")
+}
+
+// 服务端版本是否与期望版本一致，只比较期望版本给出的部分，如7.2匹配7.2.4
+func matchesServerVersion(expected string, running string) bool {
+	want, parts, ok := parseVersionParts(expected)
+	if !ok {
+		return false
+	}
+	got, ok := parseVersion(running)
+	if !ok {
+		return false
+	}
+	for i := 0; i < parts; i++ {
+		if got[i] != want[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func compareVersion(a [3]int, b [3]int) int {
+	for i := range a {
+		if a[i] != b[i] {
+			if a[i] < b[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// 版本对应的RDB格式版本，未知时返回0
+func getRDBVersion(flavor redisv1alpha1.RedisFlavor, version [3]int) int {
+	return rdbVersions[flavor][fmt.Sprintf("%d.%d", version[0], version[1])]
+}
+
+// 校验镜像变更，降级跨越RDB格式版本时已有数据无法加载
+func validateRedisImageChange(flavor redisv1alpha1.RedisFlavor, from [3]int, to [3]int) error {
+	if compareVersion(to, from) >= 0 {
+		return nil
+	}
+	fromRDB, toRDB := getRDBVersion(flavor, from), getRDBVersion(flavor, to)
+	if fromRDB == 0 || toRDB == 0 {
+		return fmt.Errorf("cannot downgrade from %s to %s, RDB compatibility is unknown", formatVersion(from), formatVersion(to))
+	}
+	if toRDB < fromRDB {
+		return fmt.Errorf("cannot downgrade from %s to %s, RDB format %d cannot be loaded by RDB format %d",
+			formatVersion(from), formatVersion(to), fromRDB, toRDB)
+	}
+	return nil
+}
+
+// INFO server中表示服务端版本的字段
+func getServerVersion(flavor redisv1alpha1.RedisFlavor, info string) string {
+	switch flavor {
+	case redisv1alpha1.RedisFlavorValkey:
+		if version := parseRedisInfo(info, "valkey_version"); version != "" {
+			return version
+		}
+	case redisv1alpha1.RedisFlavorDragonfly:
+		return strings.TrimPrefix(parseRedisInfo(info, "dragonfly_version"), "df-")
+	}
+	return parseRedisInfo(info, "redis_version")
+}
+
+// 获取statefulset中redis容器当前的镜像
+func getStatefulSetRedisImage(cr *redisv1alpha1.Redis) (string, error) {
+	sts, err := GetStatefulSet(cr.Namespace, cr.Name)
+	if err != nil {
+		return "", err
+	}
+	for _, container := range sts.Spec.Template.Spec.Containers {
+		if container.Name == cr.Name {
+			return container.Image, nil
+		}
+	}
+	return "", nil
+}
+
+// 升级前备份名称，同一目标镜像只备份一次
+func getPreUpgradeBackupName(cr *redisv1alpha1.Redis, image string) string {
+	sum := sha256.Sum256([]byte(image))
+	return fmt.Sprintf("%s-pre-upgrade-%x", cr.Name, sum[:5])
+}
+
+// 协调镜像升级，返回本次应下发到statefulset的镜像
+// 单例只有一个pod，存在从节点时statefulset按序号从大到小滚动，0号主节点最后升级
+func ReconcileRedisUpgrade(cr *redisv1alpha1.Redis, cl client.Client) (string, error) {
+	desired := getRedisImage(cr)
+	current, err := getStatefulSetRedisImage(cr)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return desired, nil
+		}
+		return "", err
+	}
+	if current == "" {
+		return desired, nil
+	}
+	status := cr.Status.Upgrade
+	if current == desired {
+		if status != nil && status.Phase == redisv1alpha1.UpgradePhaseUpgrading && status.ToImage == desired {
+			return desired, verifyRedisUpgrade(cr, cl)
+		}
+		return desired, nil
+	}
+	// 已停止或已拒绝的升级不再重试，修改镜像后重新开始
+	if status != nil && status.ToImage == desired &&
+		(status.Phase == redisv1alpha1.UpgradePhaseHalted || status.Phase == redisv1alpha1.UpgradePhaseRefused) {
+		return current, nil
+	}
+	if status == nil || status.ToImage != desired || status.FromImage != current {
+		status = &redisv1alpha1.UpgradeStatus{FromImage: current, ToImage: desired}
+	} else {
+		status = status.DeepCopy()
+	}
+	from, fromParts, fromOK := parseImageVersionParts(current)
+	to, toParts, toOK := parseImageVersionParts(desired)
+	if fromOK {
+		status.FromVersion = formatVersionParts(from, fromParts)
+	}
+	if toOK {
+		status.ToVersion = formatVersionParts(to, toParts)
+	}
+	if fromOK && toOK {
+		if err := validateRedisImageChange(getRedisFlavor(cr), from, to); err != nil {
+			recordEvent(cr, corev1.EventTypeWarning, EventReasonValidationFailed, "%v", err)
+			status.Phase = redisv1alpha1.UpgradePhaseRefused
+			status.Message = err.Error()
+			return current, updateRedisUpgradeStatus(cr, cl, status, nil)
+		}
+	}
+	// 升级前备份
+	if cr.Spec.Upgrade != nil && cr.Spec.Upgrade.PreUpgradeBackup != nil {
+		done, err := ensurePreUpgradeBackup(cr, cl, status)
+		if err != nil || !done {
+			return current, err
+		}
+	}
+	redisLogger(cr.Namespace, cr.Name).Info("Upgrading redis image", "from", current, "to", desired)
+	recordEvent(cr, corev1.EventTypeNormal, EventReasonUpgrading, "upgrading from %s to %s", current, desired)
+	now := metav1.Now()
+	status.Phase = redisv1alpha1.UpgradePhaseUpgrading
+	status.StartTime = &now
+	status.Message = ""
+	return desired, updateRedisUpgradeStatus(cr, cl, status, nil)
+}
+
+// 创建升级前备份并等待完成，返回备份是否已成功
+func ensurePreUpgradeBackup(cr *redisv1alpha1.Redis, cl client.Client, status *redisv1alpha1.UpgradeStatus) (bool, error) {
+	name := getPreUpgradeBackupName(cr, status.ToImage)
+	backup := &redisv1alpha1.RedisBackup{}
+	err := cl.Get(context.TODO(), types.NamespacedName{Namespace: cr.Namespace, Name: name}, backup)
+	if errors.IsNotFound(err) {
+		// 维护期间不创建备份
+		if IsRedisInMaintenance(cr) {
+			return false, nil
+		}
+		backup = &redisv1alpha1.RedisBackup{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: cr.Namespace},
+			Spec: redisv1alpha1.RedisBackupSpec{
+				RedisName: cr.Name,
+				Storage:   *cr.Spec.Upgrade.PreUpgradeBackup.DeepCopy(),
+			},
+		}
+		if err := cl.Create(context.TODO(), backup); err != nil {
+			return false, err
+		}
+		recordEvent(cr, corev1.EventTypeNormal, EventReasonCreated, "RedisBackup %s created before upgrading to %s", name, status.ToImage)
+	} else if err != nil {
+		return false, err
+	}
+	status.Backup = name
+	switch backup.Status.Phase {
+	case redisv1alpha1.BackupPhaseSucceeded:
+		return true, nil
+	case redisv1alpha1.BackupPhaseFailed:
+		status.Phase = redisv1alpha1.UpgradePhaseHalted
+		status.Message = "pre-upgrade backup failed: " + backup.Status.Message
+		recordEvent(cr, corev1.EventTypeWarning, EventReasonUpgradeHalted, "%s", status.Message)
+		return false, updateRedisUpgradeStatus(cr, cl, status, &metav1.Condition{
+			Status:  metav1.ConditionTrue,
+			Reason:  "PreUpgradeBackupFailed",
+			Message: status.Message,
+		})
+	}
+	if cr.Status.Upgrade != nil && cr.Status.Upgrade.Phase == redisv1alpha1.UpgradePhaseBackingUp && cr.Status.Upgrade.Backup == name {
+		return false, nil
+	}
+	status.Phase = redisv1alpha1.UpgradePhaseBackingUp
+	return false, updateRedisUpgradeStatus(cr, cl, status, nil)
+}
+
+// 等待pod就绪并通过INFO server确认版本，超时后标记为未确认
+// 此时statefulset已使用新镜像，不会自动回滚，需将镜像改回原版本
+func verifyRedisUpgrade(cr *redisv1alpha1.Redis, cl client.Client) error {
+	status := cr.Status.Upgrade.DeepCopy()
+	timeout := 600 * time.Second
+	if cr.Spec.Upgrade != nil && cr.Spec.Upgrade.ReadyTimeoutSeconds != nil {
+		timeout = time.Duration(*cr.Spec.Upgrade.ReadyTimeoutSeconds) * time.Second
+	}
+	unverified := func(reason string, message string) error {
+		status.Phase = redisv1alpha1.UpgradePhaseUnverified
+		status.Message = message + fmt.Sprintf("; the statefulset already runs %s, set the image back to %s to roll back", status.ToImage, status.FromImage)
+		recordEvent(cr, corev1.EventTypeWarning, EventReasonUpgradeUnverified, "%s", status.Message)
+		return updateRedisUpgradeStatus(cr, cl, status, &metav1.Condition{
+			Status:  metav1.ConditionTrue,
+			Reason:  reason,
+			Message: status.Message,
+		})
+	}
+	timedOut := status.StartTime != nil && time.Since(status.StartTime.Time) > timeout
+	if !isRedisStatefulSetRolledOut(cr) {
+		if timedOut {
+			return unverified("PodsNotReady", fmt.Sprintf("pods did not become ready within %s after upgrading to %s", timeout, status.ToImage))
+		}
+		return nil
+	}
+	rc, err := configureRedisClient(cr, getRedisPodName(cr))
+	if err != nil {
+		if timedOut {
+			return unverified("PodsNotReady", fmt.Sprintf("unable to connect to redis after upgrading to %s: %v", status.ToImage, err))
+		}
+		return nil
+	}
+	defer rc.Close()
+	info, err := rc.Info(context.TODO(), "server").Result()
+	if err != nil {
+		if timedOut {
+			return unverified("PodsNotReady", fmt.Sprintf("INFO server failed after upgrading to %s: %v", status.ToImage, err))
+		}
+		return nil
+	}
+	running := getServerVersion(getRedisFlavor(cr), info)
+	if status.ToVersion != "" {
+		if !matchesServerVersion(status.ToVersion, running) {
+			return unverified("VersionMismatch", fmt.Sprintf("expected version %s after upgrade, server reports %s", status.ToVersion, running))
+		}
+	}
+	redisLogger(cr.Namespace, cr.Name).Info("Redis upgrade completed", "image", status.ToImage, "version", running)
+	recordEvent(cr, corev1.EventTypeNormal, EventReasonUpgraded, "upgraded to %s, server reports version %s", status.ToImage, running)
+	status.Phase = redisv1alpha1.UpgradePhaseCompleted
+	status.Message = ""
+	return updateRedisUpgradeStatus(cr, cl, status, &metav1.Condition{
+		Status:  metav1.ConditionFalse,
+		Reason:  "UpgradeCompleted",
+		Message: fmt.Sprintf("running version %s", running),
+	})
+}
+
+// statefulset是否已完成滚动更新且所有pod就绪
+func isRedisStatefulSetRolledOut(cr *redisv1alpha1.Redis) bool {
+	sts, err := GetStatefulSet(cr.Namespace, cr.Name)
+	if err != nil || sts.Spec.Replicas == nil {
+		return false
+	}
+	return sts.Status.ObservedGeneration >= sts.Generation &&
+		sts.Status.UpdateRevision == sts.Status.CurrentRevision &&
+		sts.Status.UpdatedReplicas == *sts.Spec.Replicas &&
+		sts.Status.ReadyReplicas == *sts.Spec.Replicas
+}
+
+// 更新升级状态，degraded不为空时同时设置Degraded状态
+func updateRedisUpgradeStatus(cr *redisv1alpha1.Redis, cl client.Client, status *redisv1alpha1.UpgradeStatus, degraded *metav1.Condition) error {
+	cr.Status.Upgrade = status
+	if degraded != nil {
+		degraded.Type = redisv1alpha1.ConditionDegraded
+		degraded.ObservedGeneration = cr.Generation
+		meta.SetStatusCondition(&cr.Status.Conditions, *degraded)
+	}
+	return cl.Status().Update(context.TODO(), cr)
+}
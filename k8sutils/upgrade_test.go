@@ -0,0 +1,103 @@
+package k8sutils
+
+import (
+	"testing"
+
+	redisv1alpha1 "github.com/superwongo/redis-operator/api/v1alpha1"
+)
+
+func TestParseImageVersion(t *testing.T) {
+	tests := []struct {
+		image  string
+		want   [3]int
+		wantOK bool
+	}{
+		{image: "redis:7.2.4", want: [3]int{7, 2, 4}, wantOK: true},
+		{image: "redis:7.2.4-alpine", want: [3]int{7, 2, 4}, wantOK: true},
+		{image: "redis:7.2", want: [3]int{7, 2, 0}, wantOK: true},
+		{image: "docker.dragonflydb.io/dragonflydb/dragonfly:v1.25.1", want: [3]int{1, 25, 1}, wantOK: true},
+		{image: "eqalpha/keydb:x86_64_v6.3.4", want: [3]int{6, 3, 4}, wantOK: true},
+		{image: "registry.local:5000/redis:6.2.14", want: [3]int{6, 2, 14}, wantOK: true},
+		{image: "registry.local:5000/redis", wantOK: false},
+		{image: "redis", wantOK: false},
+		{image: "redis:latest", wantOK: false},
+		{image: "redis:7.2.4@sha256:0123456789abcdef", wantOK: false},
+	}
+	for _, tt := range tests {
+		got, ok := parseImageVersion(tt.image)
+		if ok != tt.wantOK {
+			t.Errorf("parseImageVersion(%q) ok = %v, want %v", tt.image, ok, tt.wantOK)
+			continue
+		}
+		if ok && got != tt.want {
+			t.Errorf("parseImageVersion(%q) = %v, want %v", tt.image, got, tt.want)
+		}
+	}
+}
+
+func TestValidateRedisImageChange(t *testing.T) {
+	tests := []struct {
+		name    string
+		flavor  redisv1alpha1.RedisFlavor
+		from    [3]int
+		to      [3]int
+		wantErr bool
+	}{
+		{name: "upgrade", flavor: redisv1alpha1.RedisFlavorRedis, from: [3]int{6, 2, 14}, to: [3]int{7, 2, 4}},
+		{name: "same version", flavor: redisv1alpha1.RedisFlavorRedis, from: [3]int{7, 2, 4}, to: [3]int{7, 2, 4}},
+		{name: "patch downgrade", flavor: redisv1alpha1.RedisFlavorRedis, from: [3]int{7, 2, 5}, to: [3]int{7, 2, 4}},
+		{name: "downgrade with same RDB format", flavor: redisv1alpha1.RedisFlavorRedis, from: [3]int{6, 2, 0}, to: [3]int{5, 0, 0}},
+		{name: "downgrade across RDB format", flavor: redisv1alpha1.RedisFlavorRedis, from: [3]int{7, 2, 4}, to: [3]int{7, 0, 15}, wantErr: true},
+		{name: "downgrade from unknown version", flavor: redisv1alpha1.RedisFlavorRedis, from: [3]int{8, 0, 0}, to: [3]int{7, 4, 0}, wantErr: true},
+		{name: "valkey downgrade", flavor: redisv1alpha1.RedisFlavorValkey, from: [3]int{8, 0, 1}, to: [3]int{7, 2, 7}},
+		{name: "unknown flavor downgrade", flavor: redisv1alpha1.RedisFlavorKeyDB, from: [3]int{6, 3, 4}, to: [3]int{6, 2, 0}, wantErr: true},
+	}
+	for _, tt := range tests {
+		err := validateRedisImageChange(tt.flavor, tt.from, tt.to)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: validateRedisImageChange() error = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestMatchesServerVersion(t *testing.T) {
+	tests := []struct {
+		expected string
+		running  string
+		want     bool
+	}{
+		{expected: "7.2.4", running: "7.2.4", want: true},
+		{expected: "7.2", running: "7.2.4", want: true},
+		{expected: "7.2", running: "7.4.0", want: false},
+		{expected: "7.2.4", running: "7.2.5", want: false},
+		{expected: "1.25.1", running: "1.25.1", want: true},
+		{expected: "7.2", running: "", want: false},
+	}
+	for _, tt := range tests {
+		if got := matchesServerVersion(tt.expected, tt.running); got != tt.want {
+			t.Errorf("matchesServerVersion(%q, %q) = %v, want %v", tt.expected, tt.running, got, tt.want)
+		}
+	}
+}
+
+func TestFormatImageVersion(t *testing.T) {
+	tests := []struct {
+		image string
+		want  string
+	}{
+		{image: "redis:7.2", want: "7.2"},
+		{image: "redis:7.2-alpine", want: "7.2"},
+		{image: "redis:7.2.4-alpine", want: "7.2.4"},
+		{image: "valkey/valkey:8.0.1", want: "8.0.1"},
+	}
+	for _, tt := range tests {
+		version, parts, ok := parseImageVersionParts(tt.image)
+		if !ok {
+			t.Errorf("parseImageVersionParts(%q) failed", tt.image)
+			continue
+		}
+		if got := formatVersionParts(version, parts); got != tt.want {
+			t.Errorf("formatVersionParts(parseImageVersionParts(%q)) = %q, want %q", tt.image, got, tt.want)
+		}
+	}
+}